@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -11,6 +13,9 @@ import (
 	"github.com/treybastian/twitchlinker/pkg/service"
 )
 
+// shutdownTimeout bounds how long we wait for in-flight work on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	log.Println("Starting TwitchLinker service...")
 
@@ -31,7 +36,7 @@ func main() {
 			channelNames = []string{singleChannel}
 		}
 	}
-	
+
 	config := &service.Config{
 		TwitchClientID:     getEnv("TWITCH_CLIENT_ID", ""),
 		TwitchClientSecret: getEnv("TWITCH_CLIENT_SECRET", ""),
@@ -44,7 +49,47 @@ func main() {
 		WebhookPort:        getEnv("WEBHOOK_PORT", "8080"),
 		WebhookSecret:      getEnv("WEBHOOK_SECRET", ""),
 		WebhookURL:         getEnv("WEBHOOK_URL", ""),
+		WebhookPath:        getEnv("WEBHOOK_PATH", ""),
+		WebhookAllowedIPs:  splitAndTrim(getEnv("WEBHOOK_ALLOWED_IPS", ""), ","),
+		ListenAddr:         getEnv("LISTEN_ADDR", ""),
+		TLSCertFile:        getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:         getEnv("TLS_KEY_FILE", ""),
 		PollInterval:       time.Duration(getEnvInt("POLL_INTERVAL_SECONDS", 60)) * time.Second,
+		ReconcileInterval:  time.Duration(getEnvInt("RECONCILE_INTERVAL_SECONDS", 300)) * time.Second,
+		OfflineGracePeriod: time.Duration(getEnvInt("OFFLINE_GRACE_SECONDS", 0)) * time.Second,
+		MinLiveDuration:    time.Duration(getEnvInt("MIN_LIVE_SECONDS", 0)) * time.Second,
+		StateFile:          getEnv("STATE_FILE", ""),
+
+		DeleteSubscriptionsOnShutdown: getEnvBool("DELETE_SUBSCRIPTIONS_ON_SHUTDOWN", false),
+		WebhookPreviousSecrets:        splitAndTrim(getEnv("WEBHOOK_PREVIOUS_SECRETS", ""), ","),
+		AdminToken:                    getEnv("ADMIN_TOKEN", ""),
+		ScheduleFile:                  getEnv("SCHEDULE_FILE", ""),
+		RelayFile:                     getEnv("RELAY_FILE", ""),
+
+		DiscordWebhookURL:      getEnv("DISCORD_WEBHOOK_URL", ""),
+		DiscordLiveTemplate:    getEnv("DISCORD_LIVE_TEMPLATE", ""),
+		DiscordOfflineTemplate: getEnv("DISCORD_OFFLINE_TEMPLATE", ""),
+		DiscordMinInterval:     time.Duration(getEnvInt("DISCORD_MIN_INTERVAL_SECONDS", 5)) * time.Second,
+
+		OutboundWebhookURLs:    splitAndTrim(getEnv("OUTBOUND_WEBHOOK_URLS", ""), ","),
+		OutboundWebhookSecret:  getEnv("OUTBOUND_WEBHOOK_SECRET", ""),
+		OutboundDeadLetterFile: getEnv("OUTBOUND_DEAD_LETTER_FILE", ""),
+
+		UpcomingWindow:      time.Duration(getEnvInt("UPCOMING_WINDOW_SECONDS", 0)) * time.Second,
+		UpcomingURLTemplate: getEnv("UPCOMING_URL_TEMPLATE", ""),
+
+		VODFallback:         getEnv("VOD_FALLBACK", ""),
+		VODFallbackChannels: parseChannelVideoTypes(getEnv("VOD_FALLBACK_CHANNELS", "")),
+
+		ClipFallbackPeriod:  getEnvDuration("CLIP_FALLBACK_PERIOD", 0),
+		ClipMinViews:        getEnvCount("CLIP_MIN_VIEWS", 0),
+		ClipRefreshInterval: time.Duration(getEnvInt("CLIP_REFRESH_SECONDS", 3600)) * time.Second,
+
+		TwitchTeam:          getEnv("TWITCH_TEAM", ""),
+		TeamPriority:        splitAndTrim(getEnv("TWITCH_TEAM_PRIORITY", ""), ","),
+		TeamRefreshInterval: time.Duration(getEnvInt("TWITCH_TEAM_REFRESH_SECONDS", 3600)) * time.Second,
+
+		LiveStreamTypes: splitAndTrim(getEnv("LIVE_STREAM_TYPES", "live"), ","),
 	}
 
 	// Validate required configuration
@@ -58,19 +103,21 @@ func main() {
 		log.Fatalf("Failed to create service: %v", err)
 	}
 
-	// Start service in a goroutine
-	go func() {
-		if err := svc.Start(); err != nil {
-			log.Fatalf("Service error: %v", err)
-		}
-	}()
+	// Run until we receive an interrupt signal, then shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// Wait for interrupt signal to gracefully shut down the server
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	if err := svc.Run(ctx); err != nil {
+		log.Fatalf("Service error: %v", err)
+	}
 
 	log.Println("Shutting down TwitchLinker service...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := svc.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error during shutdown: %v", err)
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -87,6 +134,11 @@ func getEnvInt(key string, defaultValue int) int {
 		return defaultValue
 	}
 
+	// Accept plain seconds as well as Go durations like "90s" or "2m"
+	if intValue, err := strconv.Atoi(value); err == nil {
+		return intValue
+	}
+
 	intValue, err := time.ParseDuration(value)
 	if err != nil {
 		log.Printf("Warning: Could not parse %s as int: %v. Using default: %d", key, err, defaultValue)
@@ -96,22 +148,69 @@ func getEnvInt(key string, defaultValue int) int {
 	return int(intValue.Seconds())
 }
 
+// getEnvCount reads a non-negative whole number, such as a number of views
+func getEnvCount(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	intValue, err := strconv.Atoi(value)
+	if err != nil || intValue < 0 {
+		log.Printf("Warning: Could not parse %s as a non-negative integer: %q. Using default: %d", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return intValue
+}
+
+// getEnvDuration reads a Go duration such as "90m" or "168h"
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Printf("Warning: Could not parse %s as a duration: %q. Using default: %s", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return duration
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: Could not parse %s as bool: %v. Using default: %t", key, err, defaultValue)
+		return defaultValue
+	}
+
+	return boolValue
+}
+
 // splitAndTrim splits a string by a separator and trims whitespace from each part
 func splitAndTrim(s, sep string) []string {
 	if s == "" {
 		return []string{}
 	}
-	
+
 	parts := strings.Split(s, sep)
 	result := make([]string, 0, len(parts))
-	
+
 	for _, part := range parts {
 		trimmed := strings.TrimSpace(part)
 		if trimmed != "" {
 			result = append(result, trimmed)
 		}
 	}
-	
+
 	return result
 }
 
@@ -122,8 +221,8 @@ func validateConfig(config *service.Config) error {
 	if config.TwitchClientSecret == "" {
 		return ErrMissingEnv("TWITCH_CLIENT_SECRET")
 	}
-	if len(config.TwitchChannelNames) == 0 {
-		return ErrMissingEnv("TWITCH_CHANNEL_NAMES (or TWITCH_CHANNEL_NAME)")
+	if len(config.TwitchChannelNames) == 0 && config.TwitchTeam == "" {
+		return ErrMissingEnv("TWITCH_CHANNEL_NAMES (or TWITCH_CHANNEL_NAME or TWITCH_TEAM)")
 	}
 	if config.CloudflareAPIToken == "" {
 		return ErrMissingEnv("CLOUDFLARE_API_TOKEN")
@@ -157,3 +256,16 @@ func (e MissingEnvError) Error() string {
 func ErrMissingEnv(envVar string) error {
 	return MissingEnvError{EnvVar: envVar}
 }
+
+// parseChannelVideoTypes parses a comma-separated list of channel:type pairs
+func parseChannelVideoTypes(s string) map[string]string {
+	types := make(map[string]string)
+	for _, pair := range splitAndTrim(s, ",") {
+		name, videoType, ok := strings.Cut(pair, ":")
+		if !ok {
+			log.Fatalf("Configuration error: invalid VOD_FALLBACK_CHANNELS entry %q, expected channel:type", pair)
+		}
+		types[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(videoType)
+	}
+	return types
+}
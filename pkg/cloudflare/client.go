@@ -5,16 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/cloudflare/cloudflare-go"
+	"github.com/treybastian/twitchlinker/pkg/metrics"
 )
 
 type Client struct {
-	api            *cloudflare.API
-	zoneID         string
-	domainName     string
-	recordName     string
-	recordType     string
+	api        *cloudflare.API
+	zoneID     string
+	domainName string
+	recordName string
+	recordType string
+
+	mu             sync.Mutex // Guards the record state below and serializes updates
 	recordID       string
 	currentURL     string
 	currentTTL     int
@@ -61,6 +65,8 @@ func (c *Client) Initialize() error {
 	}
 
 	// Store the current record details
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	record := records[0]
 	c.recordID = record.ID
 	c.currentURL = record.Content
@@ -75,8 +81,12 @@ func (c *Client) Initialize() error {
 
 // UpdateRedirect updates the domain to point to a new URL
 func (c *Client) UpdateRedirect(targetURL string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if targetURL == c.currentURL {
 		log.Printf("URL is already set to %s, no update needed", targetURL)
+		metrics.RedirectUpdates.WithLabelValues("unchanged").Inc()
 		return nil
 	}
 
@@ -99,15 +109,31 @@ func (c *Client) UpdateRedirect(targetURL string) error {
 	// Update the record
 	_, err := c.api.UpdateDNSRecord(ctx, rc, params)
 	if err != nil {
+		metrics.RedirectUpdates.WithLabelValues("error").Inc()
 		return fmt.Errorf("failed to update DNS record: %w", err)
 	}
+	metrics.RedirectUpdates.WithLabelValues("updated").Inc()
 
 	log.Printf("Successfully updated DNS record to point to: %s", targetURL)
 	c.currentURL = targetURL
 	return nil
 }
 
+// IsInitialized reports whether Initialize has found the DNS record to manage
+func (c *Client) IsInitialized() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recordID != ""
+}
+
+// GetShortLink returns the URL of the record being redirected
+func (c *Client) GetShortLink() string {
+	return "https://" + c.recordName + "." + c.domainName
+}
+
 // GetCurrentRedirect returns the current redirect URL
 func (c *Client) GetCurrentRedirect() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.currentURL
 }
@@ -0,0 +1,214 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Messages are retried after minDelay, doubling up to maxDelay, and given up
+// on after maxAttempts
+const (
+	minDelay       = time.Second
+	maxDelay       = 30 * time.Second
+	maxAttempts    = 5
+	queueSize      = 100
+	requestTimeout = 10 * time.Second
+)
+
+// Reasons a message is given up on, passed to Config.OnFailure
+var (
+	ErrQueueFull    = errors.New("queue full")
+	ErrShuttingDown = errors.New("shutting down")
+)
+
+// Message is a signed POST to deliver
+type Message struct {
+	ID          string
+	Timestamp   string // Signed with the ID and body, the same for every attempt
+	Body        []byte
+	Headers     map[string]string // Extra headers, e.g. the message type
+	Description string            // What the message is, for logs
+}
+
+// Config configures a Queue
+type Config struct {
+	Name         string // Names the destination in logs and metrics
+	URL          string
+	Secret       string
+	HeaderPrefix string                 // Prefix of the Message-Id, Message-Timestamp and Message-Signature headers
+	Deliveries   *prometheus.CounterVec // Counts outcomes by destination name and outcome: delivered, retried, failed or dropped
+
+	// OnFailure is called with every message that is given up on: after the
+	// last attempt, when the queue is full, or when it is abandoned on shutdown
+	OnFailure func(msg Message, err error, attempts int)
+}
+
+// Queue delivers messages to one URL in the order they were sent, signed the
+// same way Twitch signs EventSub notifications: an HMAC-SHA256 of the message
+// ID, timestamp and body. Failed deliveries are retried with exponential backoff.
+type Queue struct {
+	config Config
+	client *http.Client
+
+	mu     sync.Mutex // Guards closed and sends on queue
+	closed bool
+	queue  chan Message
+	stop   chan struct{} // Closed on shutdown to abandon retries
+	done   chan struct{}
+}
+
+func NewQueue(config Config) *Queue {
+	q := &Queue{
+		config: config,
+		client: &http.Client{Timeout: requestTimeout},
+		queue:  make(chan Message, queueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Send queues a message. It never blocks; if the queue is full the message
+// is given up on.
+func (q *Queue) Send(msg Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		q.giveUp(msg, ErrShuttingDown, 0)
+		return
+	}
+	select {
+	case q.queue <- msg:
+	default:
+		q.giveUp(msg, ErrQueueFull, 0)
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be
+// delivered. Once ctx is done, retries are abandoned and the remaining
+// messages are given up on.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		close(q.stop)
+		<-q.done
+		return ctx.Err()
+	}
+}
+
+// run delivers queued messages until the queue is closed and drained
+func (q *Queue) run() {
+	defer close(q.done)
+
+	for msg := range q.queue {
+		select {
+		case <-q.stop:
+			q.giveUp(msg, ErrShuttingDown, 0)
+			continue
+		default:
+		}
+
+		delay := minDelay
+		for attempt := 1; ; attempt++ {
+			err := q.deliver(msg)
+			if err == nil {
+				q.count("delivered")
+				break
+			}
+			if attempt == maxAttempts {
+				q.giveUp(msg, err, attempt)
+				break
+			}
+
+			log.Printf("Error delivering %s to %s, retrying in %s: %v", msg.Description, q.config.Name, delay, err)
+			q.count("retried")
+			if !q.wait(delay) {
+				q.giveUp(msg, err, attempt)
+				break
+			}
+			delay = min(2*delay, maxDelay)
+		}
+	}
+}
+
+// wait sleeps for delay and reports whether the queue is still running
+func (q *Queue) wait(delay time.Duration) bool {
+	select {
+	case <-time.After(delay):
+		return true
+	case <-q.stop:
+		return false
+	}
+}
+
+// deliver posts a message once
+func (q *Queue) deliver(msg Message) error {
+	req, err := http.NewRequest(http.MethodPost, q.config.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		return err
+	}
+
+	h := hmac.New(sha256.New, []byte(q.config.Secret))
+	h.Write([]byte(msg.ID + msg.Timestamp))
+	h.Write(msg.Body)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(q.config.HeaderPrefix+"Message-Id", msg.ID)
+	req.Header.Set(q.config.HeaderPrefix+"Message-Timestamp", msg.Timestamp)
+	req.Header.Set(q.config.HeaderPrefix+"Message-Signature", "sha256="+hex.EncodeToString(h.Sum(nil)))
+	for name, value := range msg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("unexpected status " + resp.Status)
+	}
+	return nil
+}
+
+// giveUp logs and counts a message that won't be delivered and hands it to OnFailure
+func (q *Queue) giveUp(msg Message, err error, attempts int) {
+	outcome := "failed"
+	if attempts == 0 {
+		outcome = "dropped"
+	}
+	log.Printf("Giving up delivering %s to %s after %d attempts: %v", msg.Description, q.config.Name, attempts, err)
+	q.count(outcome)
+
+	if q.config.OnFailure != nil {
+		q.config.OnFailure(msg, err, attempts)
+	}
+}
+
+func (q *Queue) count(outcome string) {
+	if q.config.Deliveries != nil {
+		q.config.Deliveries.WithLabelValues(q.config.Name, outcome).Inc()
+	}
+}
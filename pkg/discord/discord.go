@@ -0,0 +1,256 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Embed colors
+const (
+	colorLive    = 0x9146FF // Twitch purple
+	colorOffline = 0x808080
+)
+
+// queueSize bounds how many messages can wait for the rate limit
+const queueSize = 20
+
+// requestTimeout bounds a single webhook call
+const requestTimeout = 10 * time.Second
+
+// Default templates for the message content
+const (
+	DefaultLiveTemplate    = "{{.Channel}} is live! {{.Link}}"
+	DefaultOfflineTemplate = "Nobody is live right now, {{.Link}} now points to {{.Target}}"
+)
+
+// Change describes a redirect change to announce
+type Change struct {
+	Channel      string // Live channel the link points at, empty when falling back
+	Title        string
+	Game         string
+	ThumbnailURL string
+	Target       string // Where the link points now
+	Reason       string // Why the target was chosen
+	Link         string // The short link being redirected
+}
+
+// Config configures a Notifier
+type Config struct {
+	WebhookURL      string        // Discord webhook URL, or any URL accepting the same payload
+	LiveTemplate    string        // text/template for the message when the link switches to a channel
+	OfflineTemplate string        // text/template for the message when the link falls back
+	MinInterval     time.Duration // Minimum time between messages
+}
+
+// Notifier posts redirect changes to a Discord webhook. Messages are sent in
+// order from a single goroutine, at most one per MinInterval, and Discord's
+// rate limit responses are honoured.
+type Notifier struct {
+	webhookURL      string
+	liveTemplate    *template.Template
+	offlineTemplate *template.Template
+	minInterval     time.Duration
+	client          *http.Client
+
+	mu     sync.Mutex // Guards closed and sends on queue
+	closed bool
+	queue  chan message
+	done   chan struct{}
+}
+
+// message is the JSON payload of a Discord webhook call
+type message struct {
+	Content string  `json:"content,omitempty"`
+	Embeds  []embed `json:"embeds,omitempty"`
+}
+
+type embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Fields      []embedField `json:"fields,omitempty"`
+	Image       *embedImage  `json:"image,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+}
+
+type embedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type embedImage struct {
+	URL string `json:"url"`
+}
+
+func NewNotifier(config Config) (*Notifier, error) {
+	if config.LiveTemplate == "" {
+		config.LiveTemplate = DefaultLiveTemplate
+	}
+	if config.OfflineTemplate == "" {
+		config.OfflineTemplate = DefaultOfflineTemplate
+	}
+
+	liveTemplate, err := template.New("live").Parse(config.LiveTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Discord live template: %w", err)
+	}
+	offlineTemplate, err := template.New("offline").Parse(config.OfflineTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Discord offline template: %w", err)
+	}
+
+	n := &Notifier{
+		webhookURL:      config.WebhookURL,
+		liveTemplate:    liveTemplate,
+		offlineTemplate: offlineTemplate,
+		minInterval:     config.MinInterval,
+		client:          &http.Client{Timeout: requestTimeout},
+		queue:           make(chan message, queueSize),
+		done:            make(chan struct{}),
+	}
+	go n.run()
+	return n, nil
+}
+
+// Notify queues an announcement of a redirect change. It never blocks; if
+// too many messages are waiting the announcement is dropped.
+func (n *Notifier) Notify(change Change) {
+	msg, err := n.render(change)
+	if err != nil {
+		log.Printf("Error rendering Discord message: %v", err)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		log.Println("Discord notifier is closed, dropping notification")
+		return
+	}
+	select {
+	case n.queue <- msg:
+	default:
+		log.Println("Discord queue is full, dropping notification")
+	}
+}
+
+// Close stops accepting messages and waits for queued ones to be sent
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// render builds the message for a change: an embed describing the stream when
+// the link points at a channel, and just the offline message otherwise
+func (n *Notifier) render(change Change) (message, error) {
+	if change.Channel == "" {
+		content, err := execute(n.offlineTemplate, change)
+		return message{Content: content}, err
+	}
+
+	content, err := execute(n.liveTemplate, change)
+	if err != nil {
+		return message{}, err
+	}
+
+	e := embed{
+		Title:       change.Channel,
+		Description: change.Title,
+		URL:         change.Link,
+		Color:       colorLive,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if change.Game != "" {
+		e.Fields = append(e.Fields, embedField{Name: "Game", Value: change.Game, Inline: true})
+	}
+	e.Fields = append(e.Fields, embedField{Name: "Link", Value: change.Link, Inline: true})
+	if change.ThumbnailURL != "" {
+		e.Image = &embedImage{URL: change.ThumbnailURL}
+	}
+	return message{Content: content, Embeds: []embed{e}}, nil
+}
+
+func execute(t *template.Template, change Change) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, change); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// run sends queued messages until the queue is closed and drained
+func (n *Notifier) run() {
+	defer close(n.done)
+
+	var last time.Time
+	for msg := range n.queue {
+		if wait := n.minInterval - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		retryAfter, err := n.send(msg)
+		if err == nil && retryAfter > 0 {
+			// Rate limited, try once more when Discord allows it
+			log.Printf("Discord rate limited us, retrying in %s", retryAfter)
+			time.Sleep(retryAfter)
+			retryAfter, err = n.send(msg)
+			if err == nil && retryAfter > 0 {
+				err = fmt.Errorf("still rate limited")
+			}
+		}
+		if err != nil {
+			log.Printf("Error posting to Discord: %v", err)
+		}
+		last = time.Now()
+	}
+}
+
+// send posts a message once. It returns how long to wait before retrying if
+// Discord rate limited the request.
+func (n *Notifier) send(msg message) (time.Duration, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := n.client.Post(n.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+		if err != nil || seconds <= 0 {
+			seconds = 1
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return 0, nil
+}
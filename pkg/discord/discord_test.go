@@ -0,0 +1,181 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standIn is a local stand-in for a Discord webhook that records the
+// messages it receives
+type standIn struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	messages []message
+	times    []time.Time
+	respond  func(attempt int, w http.ResponseWriter) // nil to always accept
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("decoding message: %v", err)
+		}
+
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.times = append(s.times, time.Now())
+		attempt := len(s.messages)
+		s.mu.Unlock()
+
+		if s.respond != nil {
+			s.respond(attempt, w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// notify sends changes through a new notifier and waits for them to be posted
+func notify(t *testing.T, config Config, changes ...Change) {
+	t.Helper()
+
+	n, err := NewNotifier(config)
+	if err != nil {
+		t.Fatalf("NewNotifier: %v", err)
+	}
+	for _, change := range changes {
+		n.Notify(change)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestLiveMessage(t *testing.T) {
+	s := newStandIn(t)
+
+	notify(t, Config{
+		WebhookURL:   s.URL,
+		LiveTemplate: "{{.Channel}} is playing {{.Game}}: {{.Link}} ({{.Reason}})",
+	}, Change{
+		Channel:      "streamer",
+		Title:        "Speedruns",
+		Game:         "Celeste",
+		ThumbnailURL: "https://example.com/thumb-1280x720.jpg",
+		Target:       "https://twitch.tv/streamer",
+		Reason:       "priority",
+		Link:         "https://live.example.com",
+	})
+
+	if len(s.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(s.messages))
+	}
+	msg := s.messages[0]
+
+	if want := "streamer is playing Celeste: https://live.example.com (priority)"; msg.Content != want {
+		t.Errorf("content = %q, want %q", msg.Content, want)
+	}
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("got %d embeds, want 1", len(msg.Embeds))
+	}
+
+	e := msg.Embeds[0]
+	if e.Title != "streamer" || e.Description != "Speedruns" || e.URL != "https://live.example.com" {
+		t.Errorf("embed = %q / %q / %q, want channel, title and link", e.Title, e.Description, e.URL)
+	}
+	if e.Color != colorLive {
+		t.Errorf("color = %#x, want %#x", e.Color, colorLive)
+	}
+	if e.Image == nil || e.Image.URL != "https://example.com/thumb-1280x720.jpg" {
+		t.Errorf("image = %+v, want the thumbnail", e.Image)
+	}
+
+	fields := make(map[string]string)
+	for _, f := range e.Fields {
+		fields[f.Name] = f.Value
+	}
+	if fields["Game"] != "Celeste" || fields["Link"] != "https://live.example.com" {
+		t.Errorf("fields = %v, want Game and Link", fields)
+	}
+}
+
+func TestOfflineMessage(t *testing.T) {
+	s := newStandIn(t)
+
+	notify(t, Config{WebhookURL: s.URL}, Change{
+		Target: "https://example.com",
+		Reason: "default_fallback",
+		Link:   "https://live.example.com",
+	})
+
+	if len(s.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(s.messages))
+	}
+	msg := s.messages[0]
+
+	if want := "Nobody is live right now, https://live.example.com now points to https://example.com"; msg.Content != want {
+		t.Errorf("content = %q, want %q", msg.Content, want)
+	}
+	if len(msg.Embeds) != 0 {
+		t.Errorf("got %d embeds, want none", len(msg.Embeds))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s := newStandIn(t)
+	s.respond = func(attempt int, w http.ResponseWriter) {
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "0.2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	notify(t, Config{WebhookURL: s.URL}, Change{Channel: "streamer", Link: "https://live.example.com"})
+
+	if len(s.messages) != 2 {
+		t.Fatalf("got %d requests, want the message and one retry", len(s.messages))
+	}
+	if s.messages[0].Content != s.messages[1].Content {
+		t.Errorf("retry content = %q, want %q", s.messages[1].Content, s.messages[0].Content)
+	}
+	if waited := s.times[1].Sub(s.times[0]); waited < 200*time.Millisecond {
+		t.Errorf("retried after %s, want at least the 200ms Retry-After", waited)
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	s := newStandIn(t)
+
+	notify(t, Config{WebhookURL: s.URL, MinInterval: 200 * time.Millisecond},
+		Change{Channel: "first", Link: "https://live.example.com"},
+		Change{Channel: "second", Link: "https://live.example.com"},
+	)
+
+	if len(s.messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(s.messages))
+	}
+	if waited := s.times[1].Sub(s.times[0]); waited < 200*time.Millisecond {
+		t.Errorf("second message sent after %s, want at least 200ms", waited)
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	if _, err := NewNotifier(Config{WebhookURL: "http://localhost", LiveTemplate: "{{.Channel"}); err == nil {
+		t.Error("NewNotifier accepted an invalid template")
+	}
+}
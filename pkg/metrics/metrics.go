@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "twitchlinker"
+
+var (
+	// EventSubNotifications counts verified EventSub notifications by subscription type
+	EventSubNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eventsub_notifications_total",
+		Help:      "EventSub notifications received, by subscription type.",
+	}, []string{"type"})
+
+	// SignatureFailures counts webhook requests rejected for a bad signature
+	SignatureFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eventsub_signature_failures_total",
+		Help:      "Webhook requests rejected because of an invalid signature.",
+	})
+
+	// StaleMessages counts webhook requests rejected for an old or missing timestamp
+	StaleMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eventsub_stale_messages_total",
+		Help:      "Webhook requests rejected because their timestamp was too old or invalid.",
+	})
+
+	// DuplicateMessages counts EventSub messages acknowledged without being handled again
+	DuplicateMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eventsub_duplicate_messages_total",
+		Help:      "EventSub messages that were already processed and were only acknowledged.",
+	})
+
+	// WebhookQueueDepth is the number of acknowledged notifications waiting to be handled
+	WebhookQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "webhook_queue_depth",
+		Help:      "EventSub notifications acknowledged and waiting to be handled.",
+	})
+
+	// WebhookQueueLag observes how long notifications wait before being handled
+	WebhookQueueLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_queue_lag_seconds",
+		Help:      "Time between acknowledging an EventSub notification and starting to handle it.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// WebhookQueueRejections counts notifications rejected because the queue was full
+	WebhookQueueRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_queue_rejections_total",
+		Help:      "EventSub notifications rejected because the handling queue was full.",
+	})
+
+	// RelayDeliveries counts notifications relayed downstream by destination
+	// and outcome: delivered, retried, failed or dropped
+	RelayDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_deliveries_total",
+		Help:      "EventSub notifications relayed to downstream destinations, by destination and outcome.",
+	}, []string{"destination", "outcome"})
+
+	// OutboundDeliveries counts redirect change webhooks by destination host
+	// and outcome: delivered, retried, failed or dropped
+	OutboundDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbound_webhook_deliveries_total",
+		Help:      "Redirect change webhooks sent to outbound URLs, by destination host and outcome.",
+	}, []string{"destination", "outcome"})
+
+	// HelixRequestDuration observes Twitch Helix call latency by endpoint
+	HelixRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "helix_request_duration_seconds",
+		Help:      "Latency of Twitch Helix API calls, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// HelixRequestErrors counts failed Twitch Helix calls by endpoint
+	HelixRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "helix_request_errors_total",
+		Help:      "Twitch Helix API calls that failed or returned an error status, by endpoint.",
+	}, []string{"endpoint"})
+
+	// RedirectUpdates counts redirect updates by outcome: updated, unchanged or error
+	RedirectUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirect_updates_total",
+		Help:      "Redirect update attempts, by outcome.",
+	}, []string{"outcome"})
+
+	// LiveChannels is the number of monitored channels live at the last reconciliation
+	LiveChannels = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "live_channels",
+		Help:      "Number of monitored channels that were live at the last reconciliation.",
+	})
+
+	// SelectedChannel is 1 for the channel the redirect points at. No series
+	// is set when the redirect points at a fallback.
+	SelectedChannel = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "selected_channel",
+		Help:      "Set to 1 for the channel the redirect currently points at.",
+	}, []string{"channel"})
+
+	// PendingRetries is the number of failed reconciliations waiting to be retried
+	PendingRetries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_retries",
+		Help:      "Failed reconciliations waiting to be retried.",
+	})
+
+	// PendingTransitions is the number of stream events waiting out a grace period
+	PendingTransitions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_transitions",
+		Help:      "Stream events waiting out the offline grace period or minimum live duration.",
+	})
+
+	lastReconcile atomic.Int64
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "seconds_since_last_reconcile",
+		Help:      "Seconds since the last successful reconciliation, -1 if there has been none.",
+	}, func() float64 {
+		last := lastReconcile.Load()
+		if last == 0 {
+			return -1
+		}
+		return time.Since(time.Unix(0, last)).Seconds()
+	})
+)
+
+// SetLastReconcile records the time of the last successful reconciliation
+func SetLastReconcile(t time.Time) {
+	lastReconcile.Store(t.UnixNano())
+}
+
+// SetSelectedChannel marks channel as the redirect target, or clears the
+// selection when channel is empty
+func SetSelectedChannel(channel string) {
+	SelectedChannel.Reset()
+	if channel != "" {
+		SelectedChannel.WithLabelValues(channel).Set(1)
+	}
+}
+
+// ObserveHelix records the latency and outcome of a Twitch Helix call.
+// Status codes of 400 and above count as errors.
+func ObserveHelix(endpoint string, start time.Time, statusCode int, err error) {
+	HelixRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil || statusCode >= 400 {
+		HelixRequestErrors.WithLabelValues(endpoint).Inc()
+	}
+}
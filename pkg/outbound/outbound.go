@@ -0,0 +1,174 @@
+package outbound
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/delivery"
+	"github.com/treybastian/twitchlinker/pkg/metrics"
+)
+
+// MessageType is sent in the Twitchlinker-Message-Type header of every delivery
+const MessageType = "redirect.change"
+
+// Event describes a change of the redirect target
+type Event struct {
+	ID        string    `json:"id"`
+	From      string    `json:"from"`    // Previous target, empty if unknown
+	To        string    `json:"to"`      // New target
+	Channel   string    `json:"channel"` // Live channel the new target points at, if any
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Config configures a Sender
+type Config struct {
+	URLs           []string
+	Secret         string // Signs deliveries the same way Twitch signs EventSub notifications
+	DeadLetterFile string // Deliveries that could not be made are appended here as JSON lines
+}
+
+// Sender posts redirect changes to a list of URLs. Each URL gets its own
+// queue, so a slow or failing endpoint doesn't hold up the others, and events
+// are delivered to it in order. Events that can't be delivered are written to
+// the dead-letter log.
+type Sender struct {
+	queues     []*delivery.Queue
+	deadLetter *deadLetterLog
+}
+
+// deadLetter is a line of the dead-letter log
+type deadLetter struct {
+	URL      string          `json:"url"`
+	Event    json.RawMessage `json:"event"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// deadLetterLog appends undeliverable events to a JSON lines file
+type deadLetterLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewSender(config Config) (*Sender, error) {
+	if config.Secret == "" {
+		return nil, errors.New("a secret is required to sign outbound webhooks")
+	}
+	if config.DeadLetterFile == "" {
+		return nil, errors.New("a dead-letter file is required for outbound webhooks")
+	}
+
+	// Fail now rather than when the first event can't be delivered
+	f, err := os.OpenFile(config.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	f.Close()
+
+	s := &Sender{deadLetter: &deadLetterLog{path: config.DeadLetterFile}}
+	for _, rawURL := range config.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid outbound webhook URL %q", rawURL)
+		}
+		s.queues = append(s.queues, delivery.NewQueue(delivery.Config{
+			// The host names the URL in logs and metrics so credentials in it aren't exposed
+			Name:         u.Host,
+			URL:          rawURL,
+			Secret:       config.Secret,
+			HeaderPrefix: "Twitchlinker-",
+			Deliveries:   metrics.OutboundDeliveries,
+			OnFailure: func(msg delivery.Message, err error, attempts int) {
+				s.deadLetter.write(rawURL, msg.Body, err, attempts)
+			},
+		}))
+	}
+	return s, nil
+}
+
+// Send queues an event for every URL. It never blocks; URLs whose queue is
+// full get the event written to the dead-letter log instead.
+func (s *Sender) Send(event Event) {
+	if event.ID == "" {
+		event.ID = newMessageID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding outbound webhook: %v", err)
+		return
+	}
+
+	// Every attempt carries the same ID and timestamp, so receivers can drop
+	// redeliveries
+	for _, q := range s.queues {
+		q.Send(delivery.Message{
+			ID:          event.ID,
+			Timestamp:   event.Timestamp.Format(time.RFC3339Nano),
+			Body:        body,
+			Headers:     map[string]string{"Twitchlinker-Message-Type": MessageType},
+			Description: "redirect change " + event.ID,
+		})
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be delivered.
+// Once ctx is done, retries are abandoned and every undelivered event is
+// written to the dead-letter log.
+func (s *Sender) Close(ctx context.Context) error {
+	var errs []error
+	for _, q := range s.queues {
+		errs = append(errs, q.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// write appends an undeliverable event to the log. If the log can't be
+// written, the event is logged instead so it isn't lost without a trace.
+func (l *deadLetterLog) write(url string, body []byte, cause error, attempts int) {
+	line, err := json.Marshal(deadLetter{
+		URL:      url,
+		Event:    body,
+		Error:    cause.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Error encoding dead letter for %s: %v: %s", url, err, body)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Error opening dead-letter log, lost event: %v: %s", err, line)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing dead-letter log, lost event: %v: %s", err, line)
+	}
+}
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,178 @@
+package schedule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icalEvent is the subset of a VEVENT we use
+type icalEvent struct {
+	summary string
+	url     string
+	start   time.Time
+	end     time.Time
+}
+
+// loadICal reads the VEVENTs of an iCalendar file. Floating times without a
+// TZID are interpreted in loc.
+func loadICal(path string, loc *time.Location) ([]icalEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open iCalendar file: %w", err)
+	}
+	defer f.Close()
+	return parseICal(f, loc)
+}
+
+// parseICal reads the VEVENTs of an iCalendar stream. Recurrence rules are not
+// expanded, so recurring events are skipped rather than treated as one-offs.
+func parseICal(r io.Reader, loc *time.Location) ([]icalEvent, error) {
+	// Unfold continuation lines, which start with a space or tab
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read iCalendar file: %w", err)
+	}
+
+	var events []icalEvent
+	var current *icalEvent
+	var duration time.Duration
+	var allDay, recurring bool
+	var err error
+	for _, line := range lines {
+		name, params, value, ok := parseICalLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current, duration, allDay, recurring = &icalEvent{}, 0, false, false
+		case current == nil:
+			continue
+		case name == "END" && value == "VEVENT":
+			switch {
+			case current.start.IsZero():
+				log.Printf("Warning: Skipping iCalendar event %q without DTSTART", current.summary)
+			case recurring:
+				log.Printf("Warning: Skipping recurring iCalendar event %q, recurrence rules are not supported", current.summary)
+			default:
+				if current.end.IsZero() {
+					switch {
+					case duration > 0:
+						current.end = current.start.Add(duration)
+					case allDay:
+						current.end = current.start.AddDate(0, 0, 1)
+					default:
+						current.end = current.start
+					}
+				}
+				events = append(events, *current)
+			}
+			current = nil
+		case name == "SUMMARY":
+			current.summary = unescapeICalText(value)
+		case name == "URL":
+			current.url = value
+		case name == "DTSTART":
+			if current.start, err = parseICalTime(value, params, loc); err != nil {
+				return nil, fmt.Errorf("invalid DTSTART %q: %w", value, err)
+			}
+			allDay = params["VALUE"] == "DATE" || len(value) == 8
+		case name == "DTEND":
+			if current.end, err = parseICalTime(value, params, loc); err != nil {
+				return nil, fmt.Errorf("invalid DTEND %q: %w", value, err)
+			}
+		case name == "DURATION":
+			if duration, err = parseICalDuration(value); err != nil {
+				return nil, fmt.Errorf("invalid DURATION %q: %w", value, err)
+			}
+		case name == "RRULE" || name == "RDATE":
+			recurring = true
+		}
+	}
+
+	return events, nil
+}
+
+// parseICalLine splits a content line into its name, parameters and value
+func parseICalLine(line string) (string, map[string]string, string, bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, "", false
+	}
+
+	parts := strings.Split(head, ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value, true
+}
+
+func parseICalTime(value string, params map[string]string, loc *time.Location) (time.Time, error) {
+	if tzid := params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case len(value) == 8:
+		return time.ParseInLocation("20060102", value, loc)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+var icalDurationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICalDuration parses an RFC 5545 duration such as PT30M or P1DT2H
+func parseICalDuration(value string) (time.Duration, error) {
+	m := icalDurationPattern.FindStringSubmatch(value)
+	if m == nil || strings.Join(m[2:], "") == "" {
+		return 0, fmt.Errorf("unrecognized duration")
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+func unescapeICalText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
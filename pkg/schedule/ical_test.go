@@ -0,0 +1,183 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// vevent wraps content lines in a calendar with a single event
+func vevent(lines ...string) string {
+	return "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestParseICal(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ics  string
+		want []icalEvent // nil if the event is skipped
+	}{
+		{
+			name: "folded lines",
+			ics: vevent(
+				"SUMMARY:Charity stream\\, part",
+				"  one",
+				"URL:https://example.com/",
+				"\tcharity",
+				"DTSTART:20260301T180000Z",
+				"DTEND:20260301T200000Z",
+			),
+			want: []icalEvent{{
+				summary: "Charity stream, part one",
+				url:     "https://example.com/charity",
+				start:   time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC),
+				end:     time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "TZID overrides the default timezone",
+			ics: vevent(
+				"DTSTART;TZID=Europe/Berlin:20260301T180000",
+				"DTEND;TZID=Europe/Berlin:20260301T200000",
+			),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 1, 18, 0, 0, 0, berlin),
+				end:   time.Date(2026, 3, 1, 20, 0, 0, 0, berlin),
+			}},
+		},
+		{
+			name: "floating time uses the default timezone",
+			ics:  vevent("DTSTART:20260301T180000", "DTEND:20260301T200000"),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 1, 18, 0, 0, 0, newYork),
+				end:   time.Date(2026, 3, 1, 20, 0, 0, 0, newYork),
+			}},
+		},
+		{
+			name: "all-day event lasts a day",
+			ics:  vevent("DTSTART;VALUE=DATE:20260301"),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 1, 0, 0, 0, 0, newYork),
+				end:   time.Date(2026, 3, 2, 0, 0, 0, 0, newYork),
+			}},
+		},
+		{
+			name: "all-day event over a DST change lasts a calendar day",
+			ics:  vevent("DTSTART;VALUE=DATE:20260308"),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+				end:   time.Date(2026, 3, 9, 0, 0, 0, 0, newYork),
+			}},
+		},
+		{
+			name: "duration",
+			ics:  vevent("DTSTART:20260301T180000Z", "DURATION:PT1H30M"),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC),
+				end:   time.Date(2026, 3, 1, 19, 30, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "DTEND wins over duration",
+			ics:  vevent("DTSTART:20260301T180000Z", "DURATION:PT1H30M", "DTEND:20260301T210000Z"),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC),
+				end:   time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "no end or duration",
+			ics:  vevent("DTSTART:20260301T180000Z"),
+			want: []icalEvent{{
+				start: time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC),
+				end:   time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "recurring event is skipped",
+			ics:  vevent("DTSTART:20260301T180000Z", "DTEND:20260301T200000Z", "RRULE:FREQ=WEEKLY;BYDAY=SU"),
+		},
+		{
+			name: "event without DTSTART is skipped",
+			ics:  vevent("SUMMARY:Someday", "DTEND:20260301T200000Z"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseICal(strings.NewReader(tt.ics), newYork)
+			if err != nil {
+				t.Fatalf("parseICal: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				e := got[i]
+				if e.summary != want.summary || e.url != want.url || !e.start.Equal(want.start) || !e.end.Equal(want.end) {
+					t.Errorf("event = %+v, want %+v", e, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseICalInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		ics  string
+	}{
+		{"bad DTSTART", vevent("DTSTART:2026-03-01")},
+		{"unknown TZID", vevent("DTSTART;TZID=Nowhere/Special:20260301T180000")},
+		{"bad DURATION", vevent("DTSTART:20260301T180000Z", "DURATION:1h")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseICal(strings.NewReader(tt.ics), time.UTC); err == nil {
+				t.Error("parseICal accepted an invalid event")
+			}
+		})
+	}
+}
+
+func TestParseICalDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"PT30M", 30 * time.Minute},
+		{"PT1H30M15S", time.Hour + 30*time.Minute + 15*time.Second},
+		{"P1DT2H", 26 * time.Hour},
+		{"P2W", 14 * 24 * time.Hour},
+		{"+PT5M", 5 * time.Minute},
+		{"-PT5M", -5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseICalDuration(tt.value)
+			if err != nil {
+				t.Fatalf("parseICalDuration: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "P", "PT", "30M", "P1H", "PT1.5H"} {
+		if _, err := parseICalDuration(value); err == nil {
+			t.Errorf("parseICalDuration(%q) accepted an invalid duration", value)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Window is a period of time during which the fallback URL changes
+type Window struct {
+	Name  string    `json:"name"`
+	URL   string    `json:"url"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Schedule is an ordered list of rules that produce windows. When windows
+// overlap, the rule listed first wins.
+type Schedule struct {
+	rules []rule
+}
+
+type rule interface {
+	// active returns the window of this rule that contains t, if any
+	active(t time.Time) (Window, bool)
+	// nextBoundary returns the first window start or end after t, or the zero time if there is none
+	nextBoundary(t time.Time) time.Time
+}
+
+// fileConfig is the JSON layout of a schedule file
+type fileConfig struct {
+	Timezone string `json:"timezone"` // Default timezone for cron rules and floating iCalendar times
+	Windows  []struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		Cron     string `json:"cron"`     // Standard 5-field cron expression for when the window opens
+		Duration string `json:"duration"` // How long a cron window stays open
+		Timezone string `json:"timezone"`
+		ICal     string `json:"ical"`   // Path of an iCalendar file whose events are windows
+		Before   string `json:"before"` // Open the window this long before each event instead of during it
+	} `json:"windows"`
+}
+
+// Load reads a schedule file
+func Load(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule file: %w", err)
+	}
+
+	var cfg fileConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule file: %w", err)
+	}
+
+	defaultLoc := time.Local
+	if cfg.Timezone != "" {
+		if defaultLoc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid schedule timezone: %w", err)
+		}
+	}
+
+	s := &Schedule{}
+	for i, w := range cfg.Windows {
+		name := w.Name
+		if name == "" {
+			name = fmt.Sprintf("window %d", i+1)
+		}
+
+		loc := defaultLoc
+		if w.Timezone != "" {
+			if loc, err = time.LoadLocation(w.Timezone); err != nil {
+				return nil, fmt.Errorf("%s: invalid timezone: %w", name, err)
+			}
+		}
+
+		switch {
+		case w.Cron != "" && w.ICal != "":
+			return nil, fmt.Errorf("%s: set either cron or ical, not both", name)
+
+		case w.Cron != "":
+			if w.URL == "" {
+				return nil, fmt.Errorf("%s: url is required", name)
+			}
+			sched, err := cron.ParseStandard(w.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid cron expression: %w", name, err)
+			}
+			duration, err := time.ParseDuration(w.Duration)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("%s: duration must be a positive Go duration such as \"30m\"", name)
+			}
+			s.rules = append(s.rules, &cronRule{name: name, url: w.URL, schedule: sched, duration: duration, loc: loc})
+
+		case w.ICal != "":
+			var before time.Duration
+			if w.Before != "" {
+				if before, err = time.ParseDuration(w.Before); err != nil || before <= 0 {
+					return nil, fmt.Errorf("%s: before must be a positive Go duration such as \"30m\"", name)
+				}
+			}
+			events, err := loadICal(w.ICal, loc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			s.rules = append(s.rules, &icalRule{name: name, url: w.URL, before: before, events: events})
+
+		default:
+			return nil, fmt.Errorf("%s: either cron or ical is required", name)
+		}
+	}
+
+	if len(s.rules) == 0 {
+		return nil, errors.New("schedule file defines no windows")
+	}
+	return s, nil
+}
+
+// Active returns the highest priority window that contains t, if any
+func (s *Schedule) Active(t time.Time) (Window, bool) {
+	for _, r := range s.rules {
+		if w, ok := r.active(t); ok {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// NextBoundary returns the next time after t at which any window opens or
+// closes, or the zero time if there is none
+func (s *Schedule) NextBoundary(t time.Time) time.Time {
+	var next time.Time
+	for _, r := range s.rules {
+		if b := r.nextBoundary(t); !b.IsZero() && (next.IsZero() || b.Before(next)) {
+			next = b
+		}
+	}
+	return next
+}
+
+// cronRule opens a window of a fixed duration every time the cron expression fires
+type cronRule struct {
+	name     string
+	url      string
+	schedule cron.Schedule
+	duration time.Duration
+	loc      *time.Location
+}
+
+func (r *cronRule) active(t time.Time) (Window, bool) {
+	// The earliest start that could still be open at t
+	start := r.schedule.Next(t.Add(-r.duration).In(r.loc))
+	if start.IsZero() || start.After(t) {
+		return Window{}, false
+	}
+	return Window{Name: r.name, URL: r.url, Start: start, End: start.Add(r.duration)}, true
+}
+
+func (r *cronRule) nextBoundary(t time.Time) time.Time {
+	next := r.schedule.Next(t.In(r.loc))
+	if w, ok := r.active(t); ok && (next.IsZero() || w.End.Before(next)) {
+		next = w.End
+	}
+	return next
+}
+
+// icalRule turns each event of an iCalendar file into a window
+type icalRule struct {
+	name   string
+	url    string // Overrides the URL property of the events when set
+	before time.Duration
+	events []icalEvent
+}
+
+// window returns the window for an event, or false if the event has no URL to redirect to
+func (r *icalRule) window(e icalEvent) (Window, bool) {
+	w := Window{Name: r.name, URL: r.url, Start: e.start, End: e.end}
+	if w.URL == "" {
+		w.URL = e.url
+	}
+	if e.summary != "" {
+		w.Name = r.name + ": " + e.summary
+	}
+	if r.before > 0 {
+		w.Start, w.End = e.start.Add(-r.before), e.start
+	}
+	return w, w.URL != "" && w.End.After(w.Start)
+}
+
+func (r *icalRule) active(t time.Time) (Window, bool) {
+	for _, e := range r.events {
+		if w, ok := r.window(e); ok && !t.Before(w.Start) && t.Before(w.End) {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+func (r *icalRule) nextBoundary(t time.Time) time.Time {
+	var next time.Time
+	for _, e := range r.events {
+		w, ok := r.window(e)
+		if !ok {
+			continue
+		}
+		for _, b := range []time.Time{w.Start, w.End} {
+			if b.After(t) && (next.IsZero() || b.Before(next)) {
+				next = b
+			}
+		}
+	}
+	return next
+}
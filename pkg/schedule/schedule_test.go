@@ -0,0 +1,140 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func newCronRule(t *testing.T, name, spec string, duration time.Duration, loc *time.Location) *cronRule {
+	t.Helper()
+
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		t.Fatalf("ParseStandard(%q): %v", spec, err)
+	}
+	return &cronRule{name: name, url: "https://example.com/" + name, schedule: sched, duration: duration, loc: loc}
+}
+
+func TestCronRule(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC) }
+
+	// Every night at 23:00 UTC for two hours, crossing midnight
+	nightly := newCronRule(t, "nightly", "0 23 * * *", 2*time.Hour, time.UTC)
+	// Every night at 01:00 New York time for two hours; on 8 March 2026 the
+	// clocks go from 02:00 EST to 03:00 EDT inside the window
+	dst := newCronRule(t, "dst", "0 1 * * *", 2*time.Hour, newYork)
+
+	tests := []struct {
+		name      string
+		rule      *cronRule
+		at        time.Time
+		wantStart time.Time // Zero if no window is active
+		wantNext  time.Time
+	}{
+		{"before the window", nightly, utc(1, 22, 59), time.Time{}, utc(1, 23, 0)},
+		{"exactly at the start", nightly, utc(1, 23, 0), utc(1, 23, 0), utc(2, 1, 0)},
+		{"past midnight", nightly, utc(2, 0, 30), utc(1, 23, 0), utc(2, 1, 0)},
+		{"exactly at the end", nightly, utc(2, 1, 0), time.Time{}, utc(2, 23, 0)},
+		{"before a DST change", dst, utc(8, 5, 59), time.Time{}, utc(8, 6, 0)},
+		{"across a DST change", dst, utc(8, 7, 30), utc(8, 6, 0), utc(8, 8, 0)},
+		{"after a DST change", dst, utc(8, 8, 0), time.Time{}, utc(9, 5, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, ok := tt.rule.active(tt.at)
+			switch {
+			case tt.wantStart.IsZero() && ok:
+				t.Errorf("active = %+v, want no window", w)
+			case !tt.wantStart.IsZero() && !ok:
+				t.Errorf("no active window, want one starting at %s", tt.wantStart)
+			case ok && (!w.Start.Equal(tt.wantStart) || !w.End.Equal(tt.wantStart.Add(tt.rule.duration))):
+				t.Errorf("active = %s to %s, want %s to %s", w.Start, w.End, tt.wantStart, tt.wantStart.Add(tt.rule.duration))
+			}
+
+			if next := tt.rule.nextBoundary(tt.at); !next.Equal(tt.wantNext) {
+				t.Errorf("nextBoundary = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestICalRule(t *testing.T) {
+	utc := func(hour, minute int) time.Time { return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC) }
+	events := []icalEvent{
+		{summary: "Show", url: "https://example.com/show", start: utc(18, 0), end: utc(20, 0)},
+		{summary: "No link", start: utc(21, 0), end: utc(22, 0)},
+	}
+
+	during := &icalRule{name: "events", events: events}
+	before := &icalRule{name: "pre-show", url: "https://example.com/soon", before: 30 * time.Minute, events: events}
+
+	tests := []struct {
+		name     string
+		rule     *icalRule
+		at       time.Time
+		wantURL  string // Empty if no window is active
+		wantNext time.Time
+	}{
+		{"before the event", during, utc(17, 59), "", utc(18, 0)},
+		{"exactly at the start", during, utc(18, 0), "https://example.com/show", utc(20, 0)},
+		{"exactly at the end", during, utc(20, 0), "", time.Time{}},
+		{"event without a URL", during, utc(21, 30), "", time.Time{}},
+		{"before the pre-show", before, utc(17, 29), "", utc(17, 30)},
+		{"exactly at the pre-show start", before, utc(17, 30), "https://example.com/soon", utc(18, 0)},
+		{"exactly at the event start", before, utc(18, 0), "", utc(20, 30)},
+		{"pre-show of an event without a URL", before, utc(20, 45), "https://example.com/soon", utc(21, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, ok := tt.rule.active(tt.at)
+			if ok != (tt.wantURL != "") || w.URL != tt.wantURL {
+				t.Errorf("active = %+v, %t, want URL %q", w, ok, tt.wantURL)
+			}
+			if next := tt.rule.nextBoundary(tt.at); !next.Equal(tt.wantNext) {
+				t.Errorf("nextBoundary = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	utc := func(hour, minute int) time.Time { return time.Date(2026, 3, 1, hour, minute, 0, 0, time.UTC) }
+
+	// The hourly window is listed first, so it wins where the two overlap
+	s := &Schedule{rules: []rule{
+		newCronRule(t, "hourly", "0 * * * *", 10*time.Minute, time.UTC),
+		newCronRule(t, "evening", "0 18 * * *", 2*time.Hour, time.UTC),
+	}}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		wantName string // Empty if no window is active
+		wantNext time.Time
+	}{
+		{"no window", utc(17, 30), "", utc(18, 0)},
+		{"overlap goes to the first rule", utc(18, 5), "hourly", utc(18, 10)},
+		{"second rule once the first closes", utc(18, 10), "evening", utc(19, 0)},
+		{"earliest boundary across rules", utc(19, 55), "evening", utc(20, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, ok := s.Active(tt.at)
+			if ok != (tt.wantName != "") || w.Name != tt.wantName {
+				t.Errorf("Active = %+v, %t, want %q", w, ok, tt.wantName)
+			}
+			if next := s.NextBoundary(tt.at); !next.Equal(tt.wantNext) {
+				t.Errorf("NextBoundary = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
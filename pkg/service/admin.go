@@ -0,0 +1,185 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+)
+
+// adminHandler serves the admin API under /admin/. Every request must carry
+// the configured admin token as a bearer token.
+func (s *Service) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/channels", s.handleAddChannel)
+	mux.HandleFunc("DELETE /admin/channels/{name}", s.handleRemoveChannel)
+	mux.HandleFunc("PUT /admin/default-url", s.handleSetDefaultURL)
+	mux.HandleFunc("POST /admin/recheck", s.handleRecheck)
+	mux.HandleFunc("GET /admin/subscriptions", s.handleListSubscriptions)
+	mux.HandleFunc("DELETE /admin/subscriptions/{id}", s.handleDeleteSubscription)
+	mux.HandleFunc("PUT /admin/override", s.handleSetOverride)
+	mux.HandleFunc("DELETE /admin/override", s.handleClearOverride)
+	mux.HandleFunc("POST /admin/webhook-secret/rotate", s.handleRotateSecret)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorizeAdmin(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing admin token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Service) authorizeAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) == 1
+}
+
+// handleAddChannel resolves a channel, subscribes to its stream events and
+// starts monitoring it at the lowest priority
+func (s *Service) handleAddChannel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Channel == "" {
+		writeError(w, http.StatusBadRequest, errors.New(`expected a JSON body like {"channel": "name"}`))
+		return
+	}
+	name := strings.ToLower(req.Channel)
+
+	if err := s.twitchClient.AddChannel(name); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, twitch.ErrChannelNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	if err := s.twitchClient.SubscribeChannel(name, s.config.WebhookURL, s.getWebhookSecret()); err != nil {
+		// Polling covers the channel until a subscription works
+		log.Printf("Warning: Failed to subscribe to stream events for channel %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	delete(s.removedChannels, name)
+	if !s.isConfiguredChannel(name) {
+		s.addedChannels[name] = true
+	}
+	s.mu.Unlock()
+
+	log.Printf("Admin API: added channel %s", name)
+	s.saveState()
+	s.requestReconcile()
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// handleRemoveChannel stops monitoring a channel and deletes its subscriptions
+func (s *Service) handleRemoveChannel(w http.ResponseWriter, r *http.Request) {
+	name := strings.ToLower(r.PathValue("name"))
+	if !s.isMonitored(name) {
+		writeError(w, http.StatusNotFound, errors.New("channel is not monitored: "+name))
+		return
+	}
+
+	s.cancelPending(name, true)
+	s.cancelPending(name, false)
+	s.forgetTransitions(name)
+	if err := s.twitchClient.RemoveChannel(name); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.addedChannels, name)
+	if s.isConfiguredChannel(name) {
+		s.removedChannels[name] = true
+	}
+	s.mu.Unlock()
+
+	log.Printf("Admin API: removed channel %s", name)
+	s.saveState()
+	s.requestReconcile()
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// handleSetDefaultURL changes the URL used when no channel is live. An empty
+// URL keeps the current redirect when nothing is live.
+func (s *Service) handleSetDefaultURL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL *string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == nil {
+		writeError(w, http.StatusBadRequest, errors.New(`expected a JSON body like {"url": "https://example.com"}`))
+		return
+	}
+
+	s.mu.Lock()
+	s.defaultURL = *req.URL
+	s.defaultURLChanged = true
+	s.mu.Unlock()
+
+	log.Printf("Admin API: default URL set to %q", *req.URL)
+	s.saveState()
+	s.requestReconcile()
+	writeJSON(w, http.StatusOK, map[string]string{"default_url": *req.URL})
+}
+
+// handleRecheck forces a reconciliation
+func (s *Service) handleRecheck(w http.ResponseWriter, r *http.Request) {
+	log.Println("Admin API: forcing a re-check")
+	s.requestReconcile()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleListSubscriptions lists every EventSub subscription owned by our client ID
+func (s *Service) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.twitchClient.ListSubscriptions()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"subscriptions": subs})
+}
+
+// handleDeleteSubscription deletes an EventSub subscription by ID
+func (s *Service) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.twitchClient.DeleteSubscription(id); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	log.Printf("Admin API: deleted EventSub subscription %s", id)
+	s.saveState()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getDefaultURL returns the URL to redirect to when no channel is live
+func (s *Service) getDefaultURL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.defaultURL
+}
+
+// isConfiguredChannel reports whether a channel is in TWITCH_CHANNEL_NAMES
+func (s *Service) isConfiguredChannel(channelName string) bool {
+	for _, name := range s.config.TwitchChannelNames {
+		if strings.EqualFold(name, channelName) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+)
+
+// refreshClips looks up the top clip of every channel and reconciles, so the
+// fallback follows new clips and clips that age out of the window
+func (s *Service) refreshClips() {
+	since := time.Now().Add(-s.config.ClipFallbackPeriod)
+	clips := make(map[string]*twitch.Clip)
+	for _, name := range s.twitchClient.GetChannelNames() {
+		clip, err := s.twitchClient.GetTopClip(name, since, s.config.ClipMinViews)
+		if err != nil {
+			log.Printf("Warning: Failed to get clips for channel %s: %v", name, err)
+			continue
+		}
+		if clip != nil {
+			clips[name] = clip
+		}
+	}
+
+	s.mu.Lock()
+	s.topClips = clips
+	s.mu.Unlock()
+
+	s.requestReconcile()
+}
+
+// watchClips refreshes the top clips every ClipRefreshInterval
+func (s *Service) watchClips(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ClipRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		s.refreshClips()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// decideClip picks the top clip of the highest priority channel that has one
+func (s *Service) decideClip() (decision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range s.twitchClient.GetChannelNames() {
+		if clip, ok := s.topClips[name]; ok {
+			return decision{Target: clip.URL, Clip: clip, ClipChannel: name, Reason: reasonClip}, true
+		}
+	}
+	return decision{}, false
+}
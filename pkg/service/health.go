@@ -0,0 +1,123 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// healthCheck is the state of a single subsystem in a health or readiness report
+type healthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// handleHealthz reports that the process is alive. Subsystem checks are
+// included for information but never fail the request.
+func (s *Service) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := s.healthReport()
+	report.Status = "ok"
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleReadyz reports whether the service is able to keep the redirect up
+// to date, returning 503 if any required subsystem is not ready
+func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := s.healthReport()
+	status := http.StatusOK
+	for name, check := range report.Checks {
+		// Subscriptions are informational, polling covers channels without one
+		if !check.OK && name != "subscriptions" {
+			report.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, report)
+}
+
+func (s *Service) healthReport() *healthReport {
+	report := &healthReport{
+		Status: "ok",
+		Uptime: time.Since(s.startedAt).Round(time.Second).String(),
+		Checks: make(map[string]healthCheck),
+	}
+
+	token, expiry := s.twitchClient.GetAppAccessToken()
+	switch {
+	case token == "":
+		report.Checks["twitch_token"] = healthCheck{OK: false, Detail: "no app access token"}
+	case time.Now().After(expiry):
+		report.Checks["twitch_token"] = healthCheck{OK: false, Detail: "app access token expired at " + expiry.Format(time.RFC3339)}
+	default:
+		report.Checks["twitch_token"] = healthCheck{OK: true, Detail: "expires at " + expiry.Format(time.RFC3339)}
+	}
+
+	if s.cloudflareClient.IsInitialized() {
+		report.Checks["cloudflare"] = healthCheck{OK: true, Detail: "current target " + s.cloudflareClient.GetCurrentRedirect()}
+	} else {
+		report.Checks["cloudflare"] = healthCheck{OK: false, Detail: "DNS record not initialized"}
+	}
+
+	resolved := len(s.twitchClient.GetChannelIDs())
+	report.Checks["channels"] = healthCheck{
+		OK:     resolved > 0,
+		Detail: fmt.Sprintf("%d of %d channels resolved", resolved, len(s.twitchClient.GetChannelNames())),
+	}
+
+	covered := 0
+	coverage := s.twitchClient.GetSubscriptionCoverage()
+	for _, ok := range coverage {
+		if ok {
+			covered++
+		}
+	}
+	report.Checks["subscriptions"] = healthCheck{
+		OK:     len(coverage) > 0 && covered == len(coverage),
+		Detail: fmt.Sprintf("%d of %d channels covered by enabled subscriptions", covered, len(coverage)),
+	}
+
+	report.Checks["reconciliation"] = s.reconcileCheck()
+	return report
+}
+
+// reconcileCheck fails if the last successful reconciliation is older than
+// two safety-net intervals. Without a safety net, only the last result counts.
+func (s *Service) reconcileCheck() healthCheck {
+	s.mu.Lock()
+	last, lastErr := s.lastReconcile, s.lastReconcileErr
+	s.mu.Unlock()
+
+	if last.IsZero() {
+		if lastErr != nil {
+			return healthCheck{OK: false, Detail: "last attempt failed: " + lastErr.Error()}
+		}
+		return healthCheck{OK: false, Detail: "no successful reconciliation yet"}
+	}
+
+	age := time.Since(last).Round(time.Second)
+	detail := fmt.Sprintf("last success %s ago", age)
+	if lastErr != nil {
+		detail += ", last attempt failed: " + lastErr.Error()
+	}
+
+	if s.config.ReconcileInterval > 0 {
+		return healthCheck{OK: age <= 2*s.config.ReconcileInterval, Detail: detail}
+	}
+	return healthCheck{OK: lastErr == nil, Detail: detail}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/discord"
+	"github.com/treybastian/twitchlinker/pkg/outbound"
+)
+
+// notifyChange announces a redirect change: switching to a live channel, or
+// falling back after the last live channel went offline. It compares against
+// the target that was applied, so restarts don't announce the same channel
+// again. Overrides aren't announced, as they say nothing about who is live.
+func (s *Service) notifyChange(previousTarget string, d decision) {
+	if s.discord == nil || d.Reason == reasonOverride || d.Target == previousTarget {
+		return
+	}
+
+	// Changes between fallbacks aren't announced, only those to or from a channel
+	var previousChannel string
+	for _, name := range s.twitchClient.GetChannelNames() {
+		if s.twitchClient.GetChannelURL(name) == previousTarget {
+			previousChannel = name
+			break
+		}
+	}
+	if d.Channel == previousChannel {
+		return
+	}
+
+	change := discord.Change{
+		Channel: d.Channel,
+		Target:  d.Target,
+		Reason:  d.Reason,
+		Link:    s.cloudflareClient.GetShortLink(),
+	}
+	for _, ch := range s.twitchClient.GetChannelStatuses() {
+		if ch.Login == d.Channel {
+			change.Title = ch.Title
+			change.Game = ch.Game
+			change.ThumbnailURL = ch.ThumbnailURL
+			break
+		}
+	}
+	s.discord.Notify(change)
+}
+
+// sendTransition posts a change of the redirect target to the outbound webhooks
+func (s *Service) sendTransition(previousTarget string, d decision) {
+	if s.outbound == nil || d.Target == previousTarget {
+		return
+	}
+
+	s.outbound.Send(outbound.Event{
+		From:      previousTarget,
+		To:        d.Target,
+		Channel:   d.Channel,
+		Reason:    d.Reason,
+		Timestamp: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/state"
+)
+
+// handleSetOverride pins the redirect to a URL, optionally for a limited time
+func (s *Service) handleSetOverride(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL      string `json:"url"`
+		Duration string `json:"duration"` // Go duration such as "90m", empty for until cleared
+		SetBy    string `json:"set_by"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		writeError(w, http.StatusBadRequest, errors.New(`expected a JSON body like {"url": "https://example.com", "duration": "2h", "set_by": "name", "reason": "why"}`))
+		return
+	}
+
+	o := &state.Override{
+		URL:    req.URL,
+		SetBy:  req.SetBy,
+		Reason: req.Reason,
+		SetAt:  time.Now(),
+	}
+	if o.SetBy == "" {
+		o.SetBy = "admin"
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("duration must be a positive Go duration such as \"90m\""))
+			return
+		}
+		o.ExpiresAt = o.SetAt.Add(duration)
+	}
+
+	s.mu.Lock()
+	s.setOverrideLocked(o)
+	s.mu.Unlock()
+
+	if o.ExpiresAt.IsZero() {
+		log.Printf("Admin API: %s pinned the redirect to %s until cleared (%s)", o.SetBy, o.URL, o.Reason)
+	} else {
+		log.Printf("Admin API: %s pinned the redirect to %s until %s (%s)", o.SetBy, o.URL, o.ExpiresAt.Format(time.RFC3339), o.Reason)
+	}
+	s.saveState()
+	s.requestReconcile()
+	writeJSON(w, http.StatusOK, o)
+}
+
+// handleClearOverride removes the override and returns to stream-driven redirects
+func (s *Service) handleClearOverride(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	cleared := s.override != nil
+	s.setOverrideLocked(nil)
+	s.mu.Unlock()
+
+	if !cleared {
+		writeError(w, http.StatusNotFound, errors.New("no override is set"))
+		return
+	}
+
+	log.Println("Admin API: override cleared")
+	s.saveState()
+	s.requestReconcile()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOverrideLocked replaces the override and arms a timer to clear it when
+// it expires. An override that has already expired is dropped. s.mu must be held.
+func (s *Service) setOverrideLocked(o *state.Override) {
+	if s.overrideTimer != nil {
+		s.overrideTimer.Stop()
+		s.overrideTimer = nil
+	}
+
+	if o != nil && !o.ExpiresAt.IsZero() && !time.Now().Before(o.ExpiresAt) {
+		log.Printf("Override to %s expired at %s", o.URL, o.ExpiresAt.Format(time.RFC3339))
+		o = nil
+	}
+	s.override = o
+	if o == nil || o.ExpiresAt.IsZero() {
+		return
+	}
+
+	s.overrideTimer = time.AfterFunc(time.Until(o.ExpiresAt), func() {
+		s.mu.Lock()
+		if s.override != o {
+			// Replaced or cleared while the timer was firing
+			s.mu.Unlock()
+			return
+		}
+		s.override = nil
+		s.overrideTimer = nil
+		s.mu.Unlock()
+
+		log.Printf("Override to %s expired, re-checking stream status", o.URL)
+		s.saveState()
+		s.requestReconcile()
+	})
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/metrics"
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+)
+
+// Failed reconciliations are retried after minRetryDelay, doubling up to maxRetryDelay
+const (
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// pendingTransition is a stream.online or stream.offline event that is
+// waiting out MinLiveDuration or OfflineGracePeriod before being applied
+type pendingTransition struct {
+	online   bool
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// requestReconcile asks the reconciler to re-evaluate the redirect. If an
+// evaluation is already queued the request is coalesced into it.
+func (s *Service) requestReconcile() {
+	select {
+	case s.reconcileCh <- struct{}{}:
+	default:
+	}
+}
+
+// runReconciler is the only goroutine that decides and applies the redirect,
+// so evaluations never overlap and the newest one always wins. An evaluation
+// that is already running when ctx is cancelled is allowed to finish.
+func (s *Service) runReconciler(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.reconcileCh:
+			err := s.reconcile()
+			if err != nil {
+				log.Printf("Error reconciling redirect: %v", err)
+			}
+
+			s.mu.Lock()
+			s.lastReconcileErr = err
+			if err == nil {
+				s.lastReconcile = time.Now()
+				metrics.SetLastReconcile(s.lastReconcile)
+			}
+			s.mu.Unlock()
+
+			s.scheduleRetry(err)
+		}
+	}
+}
+
+// scheduleRetry re-runs a failed reconciliation with exponential backoff so a
+// transient Helix or Cloudflare error doesn't wait for the next event or poll.
+// A successful reconciliation resets the backoff.
+func (s *Service) scheduleRetry(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.retryDelay = 0
+		return
+	}
+	if s.retryTimer != nil {
+		return
+	}
+
+	s.retryDelay = min(max(2*s.retryDelay, minRetryDelay), maxRetryDelay)
+	log.Printf("Retrying reconciliation in %s", s.retryDelay)
+	metrics.PendingRetries.Set(1)
+	s.retryTimer = time.AfterFunc(s.retryDelay, func() {
+		s.mu.Lock()
+		s.retryTimer = nil
+		s.mu.Unlock()
+		metrics.PendingRetries.Set(0)
+		s.requestReconcile()
+	})
+}
+
+// Reasons a reconciliation chose its target
+const (
+	reasonPriority = "priority"         // Highest priority live channel
+	reasonUpcoming = "upcoming"         // No channel live, one is scheduled to start soon
+	reasonSchedule = "schedule"         // No channel live, inside a scheduled window
+	reasonVOD      = "vod"              // No channel live, latest video of a channel
+	reasonClip     = "clip"             // No channel live, top recent clip of a channel
+	reasonDefault  = "default_fallback" // No channel live, DEFAULT_URL
+	reasonNone     = "no_fallback"      // No channel live and nothing to fall back to
+	reasonOverride = "override"         // Pinned through the admin API
+)
+
+// decision is the redirect target chosen by a reconciliation and why
+type decision struct {
+	Target   string // Empty when the current redirect should be kept
+	Channel  string // Live channel the target points at, if any
+	Window   string // Scheduled window the target comes from, if any
+	Upcoming string // Channel with an upcoming scheduled stream the target points at, if any
+	Reason   string
+
+	Video        *twitch.Video // Video the target points at, if any
+	VideoChannel string        // Channel the video belongs to
+	Clip         *twitch.Clip  // Clip the target points at, if any
+	ClipChannel  string        // Channel the clip belongs to
+}
+
+// reconcile decides where the redirect should point and applies it
+func (s *Service) reconcile() error {
+	d, err := s.decide()
+	if err != nil {
+		log.Printf("Error checking stream status: %v", err)
+		s.recordError(err)
+		return err
+	}
+
+	s.mu.Lock()
+	s.desired = d
+	s.mu.Unlock()
+
+	if d.Target == "" {
+		log.Printf("No channels are live and no default URL configured, keeping current redirect")
+		s.setLiveChannel("")
+		return nil
+	}
+
+	switch d.Reason {
+	case reasonPriority:
+		log.Printf("Channel %s is live, redirecting to: %s", d.Channel, d.Target)
+	case reasonUpcoming:
+		log.Printf("No channels are currently live, channel %s is scheduled to start soon, redirecting to: %s", d.Upcoming, d.Target)
+	case reasonSchedule:
+		log.Printf("No channels are currently live, redirecting to scheduled window %q: %s", d.Window, d.Target)
+	case reasonVOD:
+		log.Printf("No channels are currently live, redirecting to the latest %s of channel %s: %s", d.Video.Type, d.VideoChannel, d.Target)
+	case reasonClip:
+		log.Printf("No channels are currently live, redirecting to the top clip of channel %s: %s", d.ClipChannel, d.Target)
+	case reasonDefault:
+		log.Printf("No channels are currently live, redirecting to default URL: %s", d.Target)
+	case reasonOverride:
+		log.Printf("Override is active, redirecting to: %s", d.Target)
+	}
+
+	previousTarget := s.cloudflareClient.GetCurrentRedirect()
+	if err := s.cloudflareClient.UpdateRedirect(d.Target); err != nil {
+		log.Printf("Error updating redirect: %v", err)
+		s.recordError(err)
+		return err
+	}
+
+	s.notifyChange(previousTarget, d)
+	s.sendTransition(previousTarget, d)
+
+	s.setLiveChannel(d.Channel)
+	return nil
+}
+
+// decide checks which channels are live and picks the highest priority one.
+// When none are, it falls back to a channel whose scheduled stream starts
+// soon, then the active scheduled window, then a channel's latest video, then
+// a channel's top clip, then the default URL.
+func (s *Service) decide() (decision, error) {
+	polledAt := time.Now()
+	liveChannels, err := s.twitchClient.GetLiveChannels()
+	if err != nil {
+		return decision{}, err
+	}
+
+	metrics.LiveChannels.Set(float64(len(liveChannels)))
+
+	isLive := make(map[string]bool, len(liveChannels))
+	for _, name := range liveChannels {
+		isLive[name] = true
+	}
+	s.applyPolledTransitions(isLive, s.twitchClient.GetChannelStatuses(), polledAt)
+
+	// Channels waiting out MinLiveDuration don't count as live yet, and
+	// channels waiting out OfflineGracePeriod still do
+	s.mu.Lock()
+	for name, p := range s.pending {
+		isLive[name] = !p.online
+	}
+	override := s.override
+	s.mu.Unlock()
+
+	// Stream status is still tracked while an override is active, it just isn't applied
+	if override != nil {
+		return decision{Target: override.URL, Reason: reasonOverride}, nil
+	}
+
+	for _, name := range s.twitchClient.GetChannelNames() {
+		if isLive[name] {
+			return decision{Target: s.twitchClient.GetChannelURL(name), Channel: name, Reason: reasonPriority}, nil
+		}
+	}
+
+	if s.config.UpcomingWindow > 0 {
+		if d, ok := s.decideUpcoming(); ok {
+			return d, nil
+		}
+	}
+
+	if s.schedule != nil {
+		if w, ok := s.schedule.Active(time.Now()); ok {
+			return decision{Target: w.URL, Window: w.Name, Reason: reasonSchedule}, nil
+		}
+	}
+
+	if s.vodFallbackEnabled() {
+		if d, ok := s.decideVOD(); ok {
+			return d, nil
+		}
+	}
+
+	if s.config.ClipFallbackPeriod > 0 {
+		if d, ok := s.decideClip(); ok {
+			return d, nil
+		}
+	}
+
+	if defaultURL := s.getDefaultURL(); defaultURL != "" {
+		return decision{Target: defaultURL, Reason: reasonDefault}, nil
+	}
+	return decision{Reason: reasonNone}, nil
+}
+
+// setLiveChannel records which channel the redirect points at and persists
+// the change. An empty name means no channel is live.
+func (s *Service) setLiveChannel(name string) {
+	s.mu.Lock()
+	if s.liveChannel == name {
+		s.mu.Unlock()
+		return
+	}
+	s.liveChannel = name
+	metrics.SetSelectedChannel(name)
+	if name == "" {
+		s.liveSince = time.Time{}
+	} else {
+		s.liveSince = time.Now()
+	}
+	s.mu.Unlock()
+
+	s.saveState()
+}
+
+// schedulePending applies a transition for channelName once delay has passed,
+// unless it is cancelled by the opposite event first
+func (s *Service) schedulePending(channelName string, online bool, delay time.Duration) {
+	defer s.saveState()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.pending[channelName]; ok {
+		if p.online == online {
+			// Keep the original deadline rather than extending it on repeat events
+			return
+		}
+		p.timer.Stop()
+	}
+
+	p := &pendingTransition{online: online, deadline: time.Now().Add(delay)}
+	p.timer = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		if s.pending[channelName] != p {
+			// Cancelled or replaced while the timer was firing
+			s.mu.Unlock()
+			return
+		}
+		delete(s.pending, channelName)
+		metrics.PendingTransitions.Set(float64(len(s.pending)))
+		s.mu.Unlock()
+		s.saveState()
+
+		if online {
+			log.Printf("Channel %s has been live for %s, updating redirect", channelName, delay)
+		} else {
+			log.Printf("Channel %s has been offline for %s, updating redirect", channelName, delay)
+		}
+		s.requestReconcile()
+	})
+	s.pending[channelName] = p
+	metrics.PendingTransitions.Set(float64(len(s.pending)))
+}
+
+// cancelPending stops a pending transition of the given direction for
+// channelName and reports whether there was one to cancel
+func (s *Service) cancelPending(channelName string, online bool) bool {
+	s.mu.Lock()
+	p, ok := s.pending[channelName]
+	if !ok || p.online != online {
+		s.mu.Unlock()
+		return false
+	}
+
+	p.timer.Stop()
+	delete(s.pending, channelName)
+	metrics.PendingTransitions.Set(float64(len(s.pending)))
+	s.mu.Unlock()
+
+	s.saveState()
+	return true
+}
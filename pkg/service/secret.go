@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// getWebhookSecret returns the secret new subscriptions are signed with
+func (s *Service) getWebhookSecret() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.webhookSecret
+}
+
+// secretVerifyTimeout bounds how long a rotation waits for Twitch to verify
+// the new subscriptions
+const secretVerifyTimeout = 20 * time.Second
+
+// rotateWriteTimeout replaces the server's write timeout for a rotation, which
+// creates subscriptions for every channel and waits for their verification
+const rotateWriteTimeout = 2 * time.Minute
+
+// handleRotateSecret moves every subscription to a new webhook secret. New
+// subscriptions are created and verified before the old ones are deleted, so
+// no events are missed. The old secrets are retired once every channel has
+// switched, and kept if any channel fails so the rotation can be retried.
+func (s *Service) handleRotateSecret(w http.ResponseWriter, r *http.Request) {
+	// Without a state file the new secret would be lost on restart, leaving
+	// subscriptions signed with a secret nothing accepts
+	if s.store == nil {
+		writeError(w, http.StatusConflict, errors.New("rotating the webhook secret requires STATE_FILE, so the new secret survives a restart"))
+		return
+	}
+
+	var req struct {
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, errors.New(`expected an empty body or a JSON body like {"secret": "..."}`))
+		return
+	}
+
+	// Twitch requires secrets of 10 to 100 ASCII characters
+	secret := req.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		secret = hex.EncodeToString(b)
+	} else if len(secret) < 10 || len(secret) > 100 {
+		writeError(w, http.StatusBadRequest, errors.New("secret must be 10 to 100 characters"))
+		return
+	}
+
+	callbackURL, err := rotationCallbackURL(s.config.WebhookURL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.rotateMu.Lock()
+	defer s.rotateMu.Unlock()
+
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(rotateWriteTimeout)); err != nil {
+		log.Printf("Warning: Could not extend the write deadline for the secret rotation: %v", err)
+	}
+
+	log.Println("Admin API: rotating webhook secret")
+	s.mu.Lock()
+	previous := s.webhookSecret
+	s.webhookSecret = secret
+	s.mu.Unlock()
+
+	// Store the new secret before any subscription uses it
+	if err := s.writeState(); err != nil {
+		s.mu.Lock()
+		s.webhookSecret = previous
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to save the new secret, nothing was changed: %w", err))
+		return
+	}
+	s.webhookServer.AddSecret(secret)
+
+	failed := s.twitchClient.ResubscribeChannels(s.twitchClient.GetChannelNames(), callbackURL, secret, secretVerifyTimeout)
+	for name, err := range failed {
+		log.Printf("Error moving channel %s to the new webhook secret: %v", name, err)
+	}
+
+	// The old secrets stay accepted unless the new subscription IDs are saved
+	saveErr := s.writeState()
+	if saveErr != nil {
+		log.Printf("Error saving state after rotating the webhook secret: %v", saveErr)
+	}
+	s.refreshCoverage()
+
+	if len(failed) > 0 {
+		names := make([]string, 0, len(failed))
+		for name := range failed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to resubscribe channels, they keep their old subscriptions and the old secrets are still accepted: %v", names))
+		return
+	}
+	if saveErr != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to save the new subscriptions, the old secrets are still accepted: %w", saveErr))
+		return
+	}
+
+	s.webhookServer.RetireSecrets(secret)
+	log.Println("Admin API: all subscriptions use the new webhook secret, retired the old ones")
+	writeJSON(w, http.StatusOK, map[string]string{"secret": secret})
+}
+
+// rotationCallbackURL returns the webhook URL with a version parameter unique
+// to this rotation. Twitch rejects a subscription that duplicates the type,
+// condition and callback of an existing one, so the new subscriptions need a
+// different callback to exist next to the old ones. The notification handler
+// ignores the query string.
+func rotationCallbackURL(webhookURL string) (string, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("v", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -1,10 +1,25 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/treybastian/twitchlinker/pkg/cloudflare"
+	"github.com/treybastian/twitchlinker/pkg/discord"
+	"github.com/treybastian/twitchlinker/pkg/outbound"
+	"github.com/treybastian/twitchlinker/pkg/schedule"
+	"github.com/treybastian/twitchlinker/pkg/state"
 	"github.com/treybastian/twitchlinker/pkg/twitch"
 	"github.com/treybastian/twitchlinker/pkg/webhook"
 )
@@ -13,14 +28,60 @@ type Service struct {
 	twitchClient     *twitch.Client
 	cloudflareClient *cloudflare.Client
 	webhookServer    *webhook.WebhookServer
+	store            *state.Store       // nil when persistence is disabled
+	schedule         *schedule.Schedule // nil when no schedule file is configured
+	upcomingTemplate *template.Template // nil to use the channel page for upcoming streams
+	discord          *discord.Notifier  // nil when Discord notifications are disabled
+	outbound         *outbound.Sender   // nil when no outbound webhooks are configured
 	config           *Config
+
+	// reconcileCh wakes the reconciler goroutine. It is buffered with a
+	// capacity of one so bursts of events coalesce into a single evaluation.
+	reconcileCh chan struct{}
+
+	mu          sync.Mutex                    // Guards the reconciler state below
+	pending     map[string]*pendingTransition // Debounced transitions keyed by channel name
+	transitions map[string]transition         // Latest known transition of each channel, to discard stale events
+	liveChannel string                        // Channel the redirect points at, empty when offline
+	liveSince   time.Time
+	uncovered   string // Comma-separated channels without a working subscription, for change logging
+
+	startedAt        time.Time
+	lastReconcile    time.Time // Last successful reconciliation
+	lastReconcileErr error
+	retryTimer       *time.Timer // Set while a failed reconciliation is waiting to be retried
+	retryDelay       time.Duration
+
+	// Runtime configuration changed through the admin API
+	defaultURL        string
+	defaultURLChanged bool            // Whether defaultURL differs from the configured DEFAULT_URL
+	addedChannels     map[string]bool // Channels added at runtime
+	removedChannels   map[string]bool // Configured channels removed at runtime
+
+	override      *state.Override         // Pinned redirect, nil when not set
+	overrideTimer *time.Timer             // Clears the override when it expires
+	upcomingTimer *time.Timer             // Reconciles when the next scheduled stream enters the upcoming window
+	topClips      map[string]*twitch.Clip // Top clip of each channel that has one, from the last refresh
+
+	desired   decision    // Target chosen by the last reconciliation
+	lastEvent eventRecord // Last stream event received from Twitch
+	lastError errorRecord // Last error hit while reconciling, kept after later successes
+
+	webhookSecret string     // Secret new subscriptions are signed with, changed by rotations
+	rotateMu      sync.Mutex // Serializes webhook secret rotations
+
+	// saveMu keeps snapshots and writes of the state file in the same order
+	saveMu sync.Mutex
+
+	cancel context.CancelFunc // Stops the goroutines started by Run
+	wg     sync.WaitGroup
 }
 
 type Config struct {
 	TwitchClientID     string
 	TwitchClientSecret string
 	TwitchChannelNames []string // Changed to a slice of channel names
-	DefaultURL         string    // Added default URL fallback
+	DefaultURL         string   // Added default URL fallback
 	CloudflareAPIToken string
 	CloudflareZoneID   string
 	CloudflareDomain   string
@@ -28,7 +89,47 @@ type Config struct {
 	WebhookPort        string
 	WebhookSecret      string
 	WebhookURL         string
-	PollInterval       time.Duration
+	WebhookPath        string   // Path to receive notifications on, empty for the path of WebhookURL
+	WebhookAllowedIPs  []string // IPs or CIDR ranges allowed to post notifications, empty to allow any
+	ListenAddr         string   // host:port or unix:/path to listen on, empty for all interfaces on WebhookPort
+	TLSCertFile        string   // Serve TLS with this certificate and TLSKeyFile, empty for plain HTTP
+	TLSKeyFile         string
+	PollInterval       time.Duration // How often to poll channels without a working subscription
+	ReconcileInterval  time.Duration // How often to reconcile regardless of subscriptions, 0 to disable
+	OfflineGracePeriod time.Duration // How long a channel must stay offline before we switch away from it
+	MinLiveDuration    time.Duration // How long a channel must stay live before we switch to it
+	StateFile          string        // Path of the JSON state file, empty to disable persistence
+
+	DeleteSubscriptionsOnShutdown bool     // Remove our EventSub subscriptions when shutting down
+	WebhookPreviousSecrets        []string // Secrets still accepted for notifications during a manual rotation
+	AdminToken                    string   // Bearer token for the admin API, empty to disable it
+	ScheduleFile                  string   // Path of a JSON file of scheduled fallback windows
+	RelayFile                     string   // Path of a JSON file of destinations to relay notifications to
+
+	DiscordWebhookURL      string        // Announce redirect changes to this Discord webhook, empty to disable
+	DiscordLiveTemplate    string        // text/template for the message when the link switches to a channel
+	DiscordOfflineTemplate string        // text/template for the message when the link falls back
+	DiscordMinInterval     time.Duration // Minimum time between Discord messages
+
+	OutboundWebhookURLs    []string // POST every redirect change to these URLs
+	OutboundWebhookSecret  string   // Signs outbound webhooks
+	OutboundDeadLetterFile string   // Path of a JSON lines file of undeliverable outbound webhooks, required with OutboundWebhookURLs
+
+	UpcomingWindow      time.Duration // Redirect to a channel whose scheduled stream starts within this window, 0 to disable
+	UpcomingURLTemplate string        // text/template for the upcoming stream URL, empty for the channel page
+
+	VODFallback         string            // Video type ("archive", "highlight" or "upload") to fall back to, empty to disable
+	VODFallbackChannels map[string]string // Per-channel video type overriding VODFallback, "none" to skip the channel
+
+	ClipFallbackPeriod  time.Duration // Fall back to the top clip created within this period, 0 to disable
+	ClipMinViews        int           // Minimum views for a clip to be used as the fallback
+	ClipRefreshInterval time.Duration // How often to look for new top clips
+
+	TwitchTeam          string        // Monitor every member of this Twitch team, empty to disable
+	TeamPriority        []string      // Team members that take priority over the rest of the team, in order
+	TeamRefreshInterval time.Duration // How often to re-expand the team
+
+	LiveStreamTypes []string // Stream types that count as live, e.g. "live" or "premiere"
 }
 
 func NewService(config *Config) (*Service, error) {
@@ -57,26 +158,159 @@ func NewService(config *Config) (*Service, error) {
 		twitchClient:     twitchClient,
 		cloudflareClient: cloudflareClient,
 		config:           config,
+		reconcileCh:      make(chan struct{}, 1),
+		startedAt:        time.Now(),
+		defaultURL:       config.DefaultURL,
+		webhookSecret:    config.WebhookSecret,
+		addedChannels:    make(map[string]bool),
+		removedChannels:  make(map[string]bool),
+		pending:          make(map[string]*pendingTransition),
+		transitions:      make(map[string]transition),
+	}
+
+	if config.StateFile != "" {
+		service.store = state.NewStore(config.StateFile)
+	}
+
+	if config.UpcomingURLTemplate != "" {
+		if service.upcomingTemplate, err = template.New("upcoming").Parse(config.UpcomingURLTemplate); err != nil {
+			return nil, fmt.Errorf("invalid upcoming URL template: %w", err)
+		}
+	}
+
+	if config.VODFallback != "" && !videoTypes[config.VODFallback] {
+		return nil, fmt.Errorf("invalid VOD fallback video type: %s", config.VODFallback)
+	}
+	for name, videoType := range config.VODFallbackChannels {
+		if videoType != "none" && !videoTypes[videoType] {
+			return nil, fmt.Errorf("invalid VOD fallback video type for channel %s: %s", name, videoType)
+		}
+	}
+
+	if len(config.LiveStreamTypes) == 0 {
+		config.LiveStreamTypes = []string{webhook.StreamTypeLive}
+	}
+	for _, streamType := range config.LiveStreamTypes {
+		if !slices.Contains(webhook.StreamTypes, streamType) {
+			return nil, fmt.Errorf("invalid live stream type: %s", streamType)
+		}
+	}
+
+	if config.TwitchTeam != "" {
+		if config.TeamRefreshInterval <= 0 {
+			return nil, fmt.Errorf("team refresh interval must be positive")
+		}
+		twitchClient.SetTeam(config.TwitchTeam, config.TeamPriority)
+	}
+
+	if config.ClipFallbackPeriod > 0 && config.ClipRefreshInterval <= 0 {
+		return nil, fmt.Errorf("clip refresh interval must be positive")
+	}
+
+	if config.ScheduleFile != "" {
+		if service.schedule, err = schedule.Load(config.ScheduleFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Twitch posts notifications to the path of WEBHOOK_URL, which may differ
+	// from the path we serve if a proxy rewrites it
+	callbackPath := config.WebhookPath
+	if callbackPath == "" {
+		webhookURL, err := url.Parse(config.WebhookURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook URL: %w", err)
+		}
+		callbackPath = webhookURL.Path
+		if callbackPath == "" {
+			callbackPath = "/"
+		}
+	}
+
+	if config.DiscordWebhookURL != "" {
+		service.discord, err = discord.NewNotifier(discord.Config{
+			WebhookURL:      config.DiscordWebhookURL,
+			LiveTemplate:    config.DiscordLiveTemplate,
+			OfflineTemplate: config.DiscordOfflineTemplate,
+			MinInterval:     config.DiscordMinInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.OutboundWebhookURLs) > 0 {
+		service.outbound, err = outbound.NewSender(outbound.Config{
+			URLs:           config.OutboundWebhookURLs,
+			Secret:         config.OutboundWebhookSecret,
+			DeadLetterFile: config.OutboundDeadLetterFile,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var relay []webhook.Destination
+	if config.RelayFile != "" {
+		if relay, err = webhook.LoadDestinations(config.RelayFile); err != nil {
+			return nil, err
+		}
 	}
 
 	// Initialize webhook server
-	webhookServer := webhook.NewWebhookServer(
-		config.WebhookPort,
-		config.WebhookSecret,
-		service,
-	)
+	webhookServer, err := webhook.NewWebhookServer(webhook.Config{
+		Port:            config.WebhookPort,
+		Addr:            config.ListenAddr,
+		TLSCertFile:     config.TLSCertFile,
+		TLSKeyFile:      config.TLSKeyFile,
+		Secret:          config.WebhookSecret,
+		PreviousSecrets: config.WebhookPreviousSecrets,
+		CallbackPath:    callbackPath,
+		AllowedIPs:      config.WebhookAllowedIPs,
+		Relay:           relay,
+	}, service)
+	if err != nil {
+		return nil, err
+	}
 
 	service.webhookServer = webhookServer
+	webhookServer.Handle("/healthz", http.HandlerFunc(service.handleHealthz))
+	webhookServer.Handle("/readyz", http.HandlerFunc(service.handleReadyz))
+	webhookServer.Handle("/metrics", promhttp.Handler())
+	webhookServer.Handle("/status", http.HandlerFunc(service.handleStatus))
+	if config.AdminToken != "" {
+		webhookServer.Handle("/admin/", service.adminHandler())
+	}
 
 	return service, nil
 }
 
-func (s *Service) Start() error {
+// Run initializes the API clients, subscribes to stream events and serves
+// webhooks until ctx is cancelled or the webhook server fails. Call Shutdown
+// afterwards to stop background work and let in-flight requests finish.
+func (s *Service) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	// Restore state from the previous run before talking to any API
+	restored := s.loadState()
+
 	// Initialize API clients
 	log.Println("Initializing Twitch API client...")
 	if err := s.twitchClient.Initialize(); err != nil {
 		return err
 	}
+	if s.config.TwitchTeam != "" {
+		// Check the restored subscriptions first, or expanding the team would
+		// try to create them again for members it doesn't know are covered
+		if err := s.twitchClient.RefreshSubscriptions(); err != nil {
+			log.Printf("Warning: Could not verify stored EventSub subscriptions: %v", err)
+		}
+		log.Printf("Expanding Twitch team %s...", s.config.TwitchTeam)
+		s.refreshTeam()
+	}
 
 	log.Println("Initializing Cloudflare API client...")
 	if err := s.cloudflareClient.Initialize(); err != nil {
@@ -85,128 +319,340 @@ func (s *Service) Start() error {
 
 	// Subscribe to Twitch stream events
 	channels := s.twitchClient.GetChannelNames()
-	channelList := "'"+channels[0]+"'"
-	for i := 1; i < len(channels); i++ {
-		channelList += ", '" + channels[i] + "'"
+	if len(channels) == 0 {
+		return errors.New("no channels to monitor: check TWITCH_CHANNEL_NAMES and TWITCH_TEAM, and delete STATE_FILE if every channel was removed through the admin API")
 	}
-	log.Printf("Subscribing to stream events for channels: %s", channelList)
-	
-	if err := s.twitchClient.SubscribeToStreamStatus(s.config.WebhookURL, s.config.WebhookSecret); err != nil {
+	log.Printf("Subscribing to stream events for channels: '%s'", strings.Join(channels, "', '"))
+
+	if err := s.twitchClient.SubscribeToStreamStatus(s.config.WebhookURL, s.getWebhookSecret()); err != nil {
 		log.Printf("Warning: Failed to subscribe to stream events: %v", err)
-		log.Println("Falling back to polling for stream status")
-		go s.startPolling()
+		log.Printf("Channels without a working subscription will be polled every %s", s.config.PollInterval)
+	}
+
+	// Poll channels that lack a working subscription, and reconcile everything
+	// on a slower interval in case a webhook notification is dropped
+	s.goBackground(func() { s.startPolling(ctx) })
+	if s.config.ReconcileInterval > 0 {
+		s.goBackground(func() { s.startSafetyNet(ctx) })
+	}
+	if s.schedule != nil {
+		s.goBackground(func() { s.watchSchedule(ctx) })
+	}
+	if s.config.ClipFallbackPeriod > 0 {
+		s.goBackground(func() { s.watchClips(ctx) })
+	}
+	if s.config.TwitchTeam != "" {
+		s.goBackground(func() { s.watchTeam(ctx) })
 	}
 
-	// Check current stream status
-	if err := s.checkStreamStatus(); err != nil {
-		log.Printf("Warning: Initial stream status check failed: %v", err)
+	if restored != nil {
+		s.restorePending(restored)
 	}
+	s.saveState()
+
+	// Start the reconciler and check current stream status
+	s.goBackground(func() { s.runReconciler(ctx) })
+	s.requestReconcile()
 
 	// Start webhook server
-	return s.webhookServer.Start()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- s.webhookServer.Start()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-serverErr:
+		return err
+	}
+}
+
+// Shutdown stops the webhook server and background goroutines, waiting for
+// in-flight webhook requests and redirect updates to finish or ctx to expire
+func (s *Service) Shutdown(ctx context.Context) error {
+	if err := s.webhookServer.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down webhook server: %v", err)
+	}
+
+	// Pending transitions stay in the state file and are re-armed on the next start
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for _, p := range s.pending {
+		p.timer.Stop()
+	}
+	if s.retryTimer != nil {
+		s.retryTimer.Stop()
+	}
+	if s.overrideTimer != nil {
+		s.overrideTimer.Stop()
+	}
+	if s.upcomingTimer != nil {
+		s.upcomingTimer.Stop()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	// On timeout the queues below are still closed, which writes undelivered
+	// outbound webhooks to the dead-letter file, and state is still saved
+	var err error
+	select {
+	case <-done:
+		if s.config.DeleteSubscriptionsOnShutdown {
+			log.Println("Deleting EventSub subscriptions...")
+			if err := s.twitchClient.DeleteSubscriptions(); err != nil {
+				log.Printf("Error deleting EventSub subscriptions: %v", err)
+			}
+		}
+	case <-ctx.Done():
+		err = fmt.Errorf("background work did not stop in time: %w", ctx.Err())
+		if s.config.DeleteSubscriptionsOnShutdown {
+			log.Println("Not deleting EventSub subscriptions, the shutdown timed out")
+		}
+	}
+
+	// Announcements queued after this are dropped, or written to the
+	// dead-letter file for outbound webhooks
+	if s.discord != nil {
+		if err := s.discord.Close(ctx); err != nil {
+			log.Printf("Error sending queued Discord messages: %v", err)
+		}
+	}
+	if s.outbound != nil {
+		if err := s.outbound.Close(ctx); err != nil {
+			log.Printf("Error delivering queued outbound webhooks: %v", err)
+		}
+	}
+
+	s.saveState()
+	return err
 }
 
-func (s *Service) startPolling() {
+// goBackground runs f in a goroutine that Shutdown waits for
+func (s *Service) goBackground(f func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f()
+	}()
+}
+
+// startPolling reconciles every PollInterval while any channel is not covered
+// by a working EventSub subscription
+func (s *Service) startPolling(ctx context.Context) {
 	ticker := time.NewTicker(s.config.PollInterval)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-		if err := s.checkStreamStatus(); err != nil {
-			log.Printf("Error checking stream status during polling: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.allCovered() {
+				continue
+			}
+			// Subscriptions may have been verified since we last looked
+			if len(s.refreshCoverage()) > 0 {
+				s.requestReconcile()
+			}
 		}
 	}
 }
 
-func (s *Service) checkStreamStatus() error {
-	isLive, streamURL, err := s.twitchClient.IsStreamLive()
-	if err != nil {
-		log.Printf("Error checking stream status: %v", err)
-		return err
+// startSafetyNet reconciles every ReconcileInterval regardless of transport,
+// so a dropped webhook notification can't leave the redirect stale for long
+func (s *Service) startSafetyNet(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshCoverage()
+			s.requestReconcile()
+		}
 	}
+}
 
-	if isLive {
-		log.Printf("Found a live channel, redirecting to: %s", streamURL)
-		if err := s.cloudflareClient.UpdateRedirect(streamURL); err != nil {
-			log.Printf("Error updating redirect: %v", err)
-			return err
+// watchSchedule reconciles whenever a scheduled window opens or closes
+func (s *Service) watchSchedule(ctx context.Context) {
+	for {
+		next := s.schedule.NextBoundary(time.Now())
+		if next.IsZero() {
+			log.Println("No upcoming scheduled window changes")
+			return
 		}
-	} else {
-		log.Printf("No channels are currently live, redirecting to default URL: %s", s.config.DefaultURL)
-		if s.config.DefaultURL != "" {
-			if err := s.cloudflareClient.UpdateRedirect(s.config.DefaultURL); err != nil {
-				log.Printf("Error updating redirect to default URL: %v", err)
-				return err
-			}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			log.Println("Scheduled window boundary reached, re-checking redirect")
+			s.requestReconcile()
+		}
+	}
+}
+
+// allCovered reports whether every channel has a working subscription as of
+// the last refresh
+func (s *Service) allCovered() bool {
+	for _, covered := range s.twitchClient.GetSubscriptionCoverage() {
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshCoverage updates subscription status from Twitch and returns the
+// channels that are not covered by a working subscription
+func (s *Service) refreshCoverage() []string {
+	if err := s.twitchClient.RefreshSubscriptions(); err != nil {
+		log.Printf("Warning: Failed to refresh EventSub subscription status: %v", err)
+	}
+	s.saveState()
+
+	var uncovered []string
+	for name, covered := range s.twitchClient.GetSubscriptionCoverage() {
+		if !covered {
+			uncovered = append(uncovered, name)
+		}
+	}
+	sort.Strings(uncovered)
+
+	list := strings.Join(uncovered, ", ")
+	s.mu.Lock()
+	changed := list != s.uncovered
+	s.uncovered = list
+	s.mu.Unlock()
+
+	if changed {
+		if list == "" {
+			log.Println("All channels are covered by EventSub subscriptions")
 		} else {
-			log.Printf("No default URL configured, keeping current redirect")
+			log.Printf("Channels without a working EventSub subscription: %s", list)
 		}
 	}
-	
-	return nil
+	return uncovered
 }
 
 // HandleStreamOnline implements webhook.StreamStatusHandler
-func (s *Service) HandleStreamOnline(channelName string) error {
+func (s *Service) HandleStreamOnline(event *webhook.StreamOnlineEvent, sentAt time.Time) error {
+	channelName := event.BroadcasterUserLogin
 	log.Printf("Stream went online for channel: %s", channelName)
+	s.recordEvent("stream.online", channelName)
 
-	// Verify this is one of our monitored channels
-	channelNames := s.twitchClient.GetChannelNames()
-	isMonitored := false
-	for _, name := range channelNames {
-		if channelName == name {
-			isMonitored = true
-			break
-		}
+	if !s.isMonitored(channelName) {
+		log.Printf("Ignoring event for unmonitored channel: %s", channelName)
+		return nil
 	}
 
-	if !isMonitored {
-		log.Printf("Ignoring event for unmonitored channel: %s", channelName)
+	// The type is recorded even for streams that don't count as live, so
+	// polls, which can't tell stream types apart, keep ignoring them
+	if !s.recordTransition(channelName, true, event.Type, onlineEventTime(event.StartedAt, sentAt)) {
+		log.Printf("Discarding stale stream.online for channel %s, a newer transition is already known", channelName)
+		return nil
+	}
+
+	if !s.countsAsLive(event.Type) {
+		log.Printf("Ignoring %s stream for channel %s, it doesn't count as live", event.Type, channelName)
+		s.requestReconcile()
+		return nil
+	}
+
+	// A pending offline transition means the channel dropped briefly and came
+	// back inside the grace period, so the redirect never has to change
+	if s.cancelPending(channelName, false) {
+		log.Printf("Channel %s came back online within the offline grace period, keeping current redirect", channelName)
+		return nil
+	}
+
+	if s.config.MinLiveDuration <= 0 {
+		// Recheck all streams to get the priority (in case multiple channels are live)
+		s.requestReconcile()
 		return nil
 	}
 
-	// Recheck all streams to get the priority (in case multiple channels are live)
-	return s.checkStreamStatus()
+	log.Printf("Waiting %s before switching to channel %s", s.config.MinLiveDuration, channelName)
+	s.schedulePending(channelName, true, s.config.MinLiveDuration)
+	return nil
 }
 
-// HandleStreamOffline implements webhook.StreamStatusHandler
-func (s *Service) HandleStreamOffline(channelName string) error {
-	log.Printf("Stream went offline for channel: %s", channelName)
+// HandleRevocation implements webhook.StreamStatusHandler. The channel is
+// polled until a new subscription is verified.
+func (s *Service) HandleRevocation(sub *webhook.EventSubSubscription) error {
+	channelName, ok := s.twitchClient.DropSubscription(sub.ID)
+	if !ok {
+		log.Printf("Ignoring revocation of unknown subscription %s", sub.ID)
+		return nil
+	}
+	log.Printf("Lost %s subscription for channel %s (%s), polling it and subscribing again", sub.Type, channelName, sub.Status)
 
-	// Verify this is one of our monitored channels
-	channelNames := s.twitchClient.GetChannelNames()
-	isMonitored := false
-	for _, name := range channelNames {
-		if channelName == name {
-			isMonitored = true
-			break
+	var err error
+	if s.isMonitored(channelName) {
+		if err = s.twitchClient.SubscribeChannel(channelName, s.config.WebhookURL, s.getWebhookSecret()); err != nil {
+			err = fmt.Errorf("resubscribing channel %s: %w", channelName, err)
 		}
 	}
 
-	if !isMonitored {
+	s.refreshCoverage()
+	s.requestReconcile()
+	return err
+}
+
+// HandleStreamOffline implements webhook.StreamStatusHandler
+func (s *Service) HandleStreamOffline(event *webhook.StreamOfflineEvent, sentAt time.Time) error {
+	channelName := event.BroadcasterUserLogin
+	log.Printf("Stream went offline for channel: %s", channelName)
+	s.recordEvent("stream.offline", channelName)
+
+	if !s.isMonitored(channelName) {
 		log.Printf("Ignoring event for unmonitored channel: %s", channelName)
 		return nil
 	}
 
-	// Recheck all streams to see if any other channel is live
-	isLive, streamURL, err := s.twitchClient.IsStreamLive()
-	if err != nil {
-		log.Printf("Error checking stream status: %v", err)
-		return err
+	if !s.recordTransition(channelName, false, "", sentAt) {
+		log.Printf("Discarding stale stream.offline for channel %s, a newer transition is already known", channelName)
+		return nil
+	}
+
+	// The archive of the stream that just ended is now the channel's latest video
+	s.twitchClient.InvalidateVideos(channelName)
+
+	// The channel went offline before it was live long enough to switch to
+	if s.cancelPending(channelName, true) {
+		log.Printf("Channel %s went offline before the minimum live duration, not switching to it", channelName)
+		return nil
 	}
 
-	if isLive {
-		// Another channel is live, update to that one
-		log.Printf("Another channel is live, updating redirect to: %s", streamURL)
-		return s.cloudflareClient.UpdateRedirect(streamURL)
-	} 
-	
-	// No channels are live, use default URL if configured
-	if s.config.DefaultURL != "" {
-		log.Printf("No channels are live, redirecting to default URL: %s", s.config.DefaultURL)
-		return s.cloudflareClient.UpdateRedirect(s.config.DefaultURL)
+	if s.config.OfflineGracePeriod <= 0 {
+		// Recheck all streams to see if any other channel is live
+		s.requestReconcile()
+		return nil
 	}
-	
-	log.Printf("No channels are live and no default URL configured, keeping current redirect")
+
+	log.Printf("Waiting %s before switching away from channel %s", s.config.OfflineGracePeriod, channelName)
+	s.schedulePending(channelName, false, s.config.OfflineGracePeriod)
 	return nil
 }
+
+// isMonitored reports whether channelName is one of our monitored channels
+func (s *Service) isMonitored(channelName string) bool {
+	for _, name := range s.twitchClient.GetChannelNames() {
+		if channelName == name {
+			return true
+		}
+	}
+	return false
+}
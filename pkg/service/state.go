@@ -0,0 +1,140 @@
+package service
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/state"
+)
+
+// loadState reads the state file and hands the parts owned by the API clients
+// back to them. It returns nil when persistence is disabled or nothing could be loaded.
+func (s *Service) loadState() *state.State {
+	if s.store == nil {
+		return nil
+	}
+
+	st, err := s.store.Load()
+	if err != nil {
+		log.Printf("Warning: Failed to load state, starting fresh: %v", err)
+		return nil
+	}
+
+	s.twitchClient.SetAppAccessToken(st.AccessToken, st.TokenExpiry)
+	s.twitchClient.SetSubscriptions(st.Subscriptions)
+
+	s.mu.Lock()
+	s.liveChannel = st.LiveChannel
+	s.liveSince = st.LiveSince
+	if st.DefaultURL != nil {
+		s.defaultURL = *st.DefaultURL
+		s.defaultURLChanged = true
+		log.Printf("Restored default URL: %s", s.defaultURL)
+	}
+	if st.Override != nil {
+		s.setOverrideLocked(st.Override)
+	}
+	if st.WebhookSecret != "" {
+		// Subscriptions from the last rotation are signed with it, so keep
+		// accepting WEBHOOK_SECRET as well in case it was changed since
+		s.webhookSecret = st.WebhookSecret
+		s.webhookServer.AddSecret(st.WebhookSecret)
+		log.Println("Restored rotated webhook secret")
+	}
+	for _, name := range st.AddedChannels {
+		s.addedChannels[name] = true
+	}
+	for _, name := range st.RemovedChannels {
+		s.removedChannels[name] = true
+	}
+	s.mu.Unlock()
+
+	// Apply channels added or removed at runtime on top of the configured list
+	if len(st.AddedChannels) > 0 || len(st.RemovedChannels) > 0 {
+		var channelNames []string
+		for _, name := range s.config.TwitchChannelNames {
+			if !slices.Contains(st.RemovedChannels, strings.ToLower(name)) {
+				channelNames = append(channelNames, name)
+			}
+		}
+		channelNames = append(channelNames, st.AddedChannels...)
+		s.twitchClient.SetChannelNames(channelNames)
+		log.Printf("Restored runtime channel changes (added: %v, removed: %v)", st.AddedChannels, st.RemovedChannels)
+	}
+
+	if st.LiveChannel != "" {
+		log.Printf("Restored state: channel %s live since %s", st.LiveChannel, st.LiveSince.Format(time.RFC3339))
+	}
+	return st
+}
+
+// restorePending re-arms debounce timers that were still running when the
+// service stopped, keeping their original deadlines
+func (s *Service) restorePending(st *state.State) {
+	for name, p := range st.Pending {
+		if !s.isMonitored(name) {
+			continue
+		}
+		delay := max(time.Until(p.Deadline), 0)
+		log.Printf("Restored pending transition for channel %s (online: %t, remaining: %s)", name, p.Online, delay)
+		s.schedulePending(name, p.Online, delay)
+	}
+}
+
+// saveState writes the current state to the state file, if one is configured
+func (s *Service) saveState() {
+	if err := s.writeState(); err != nil {
+		log.Printf("Warning: Failed to save state: %v", err)
+	}
+}
+
+// writeState writes the state file, for callers that can't go on without it
+func (s *Service) writeState() error {
+	if s.store == nil {
+		return nil
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	st := &state.State{
+		Pending:       make(map[string]state.PendingTransition),
+		Subscriptions: s.twitchClient.GetSubscriptions(),
+	}
+	st.AccessToken, st.TokenExpiry = s.twitchClient.GetAppAccessToken()
+
+	s.mu.Lock()
+	st.LiveChannel = s.liveChannel
+	st.LiveSince = s.liveSince
+	st.AddedChannels = sortedKeys(s.addedChannels)
+	st.RemovedChannels = sortedKeys(s.removedChannels)
+	if s.defaultURLChanged {
+		defaultURL := s.defaultURL
+		st.DefaultURL = &defaultURL
+	}
+	if s.override != nil {
+		o := *s.override
+		st.Override = &o
+	}
+	if s.webhookSecret != s.config.WebhookSecret {
+		st.WebhookSecret = s.webhookSecret
+	}
+	for name, p := range s.pending {
+		st.Pending[name] = state.PendingTransition{Online: p.online, Deadline: p.deadline}
+	}
+	s.mu.Unlock()
+
+	return s.store.Save(st)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/state"
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+)
+
+// eventRecord is a stream event as shown in the status output
+type eventRecord struct {
+	Type    string    `json:"type"`
+	Channel string    `json:"channel"`
+	At      time.Time `json:"at"`
+}
+
+// errorRecord is a reconciliation error as shown in the status output
+type errorRecord struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+type channelStatus struct {
+	twitch.ChannelStatus
+	State      string                  `json:"state"`                     // "live", "upcoming" or "offline"
+	NextStream *twitch.ScheduleSegment `json:"next_stream,omitempty"`     // From the cached Twitch schedule
+	Subscribed bool                    `json:"subscribed"`                // Covered by enabled EventSub subscriptions
+	Pending    string                  `json:"pending,omitempty"`         // "online" or "offline" while a grace period runs
+	Transition *transition             `json:"last_transition,omitempty"` // Latest transition from events or polls
+}
+
+type statusResponse struct {
+	Channels        []channelStatus `json:"channels"`
+	AppliedTarget   string          `json:"applied_target"`
+	DesiredTarget   string          `json:"desired_target"`
+	Reason          string          `json:"reason"`
+	SelectedChannel string          `json:"selected_channel,omitempty"`
+	UpcomingChannel string          `json:"upcoming_channel,omitempty"`
+	ScheduleWindow  string          `json:"schedule_window,omitempty"`
+	Video           *twitch.Video   `json:"video,omitempty"`
+	VideoChannel    string          `json:"video_channel,omitempty"`
+	Clip            *twitch.Clip    `json:"clip,omitempty"`
+	ClipChannel     string          `json:"clip_channel,omitempty"`
+	NextScheduled   *time.Time      `json:"next_schedule_change,omitempty"`
+	LiveSince       *time.Time      `json:"live_since,omitempty"`
+	Override        *state.Override `json:"override,omitempty"`
+	LastEvent       *eventRecord    `json:"last_event,omitempty"`
+	LastError       *errorRecord    `json:"last_error,omitempty"`
+}
+
+// handleStatus describes every monitored channel and the current routing decision
+func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+func (s *Service) status() *statusResponse {
+	coverage := s.twitchClient.GetSubscriptionCoverage()
+	resp := &statusResponse{
+		AppliedTarget: s.cloudflareClient.GetCurrentRedirect(),
+	}
+	if s.schedule != nil {
+		if next := s.schedule.NextBoundary(time.Now()); !next.IsZero() {
+			resp.NextScheduled = &next
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ch := range s.twitchClient.GetChannelStatuses() {
+		status := channelStatus{
+			ChannelStatus: ch,
+			State:         "offline",
+			NextStream:    s.twitchClient.GetCachedNextSegment(ch.Login),
+			Subscribed:    coverage[ch.Login],
+		}
+		switch {
+		case ch.Live:
+			status.State = "live"
+		case status.NextStream != nil && s.config.UpcomingWindow > 0 &&
+			time.Until(status.NextStream.Start) <= s.config.UpcomingWindow:
+			status.State = "upcoming"
+		}
+		if p, ok := s.pending[ch.Login]; ok {
+			if p.online {
+				status.Pending = "online"
+			} else {
+				status.Pending = "offline"
+			}
+		}
+		if t, ok := s.transitions[ch.Login]; ok {
+			status.Transition = &t
+		}
+		resp.Channels = append(resp.Channels, status)
+	}
+
+	resp.DesiredTarget = s.desired.Target
+	resp.Reason = s.desired.Reason
+	resp.ScheduleWindow = s.desired.Window
+	resp.UpcomingChannel = s.desired.Upcoming
+	resp.Video = s.desired.Video
+	resp.VideoChannel = s.desired.VideoChannel
+	resp.Clip = s.desired.Clip
+	resp.ClipChannel = s.desired.ClipChannel
+	resp.SelectedChannel = s.liveChannel
+	if !s.liveSince.IsZero() {
+		liveSince := s.liveSince
+		resp.LiveSince = &liveSince
+	}
+	if s.override != nil {
+		override := *s.override
+		resp.Override = &override
+	}
+	if !s.lastEvent.At.IsZero() {
+		lastEvent := s.lastEvent
+		resp.LastEvent = &lastEvent
+	}
+	if !s.lastError.At.IsZero() {
+		lastError := s.lastError
+		resp.LastError = &lastError
+	}
+	return resp
+}
+
+// recordEvent remembers the last stream event for the status output
+func (s *Service) recordEvent(eventType, channelName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastEvent = eventRecord{Type: eventType, Channel: channelName, At: time.Now()}
+}
+
+// recordError remembers the last reconciliation error for the status output
+func (s *Service) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = errorRecord{Message: err.Error(), At: time.Now()}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// refreshTeam re-expands the team and reconciles if its members changed
+func (s *Service) refreshTeam() {
+	joined, left, err := s.twitchClient.RefreshTeam(s.config.WebhookURL, s.getWebhookSecret())
+	if err != nil {
+		log.Printf("Warning: Failed to refresh team %s: %v", s.config.TwitchTeam, err)
+	}
+
+	for _, name := range left {
+		s.cancelPending(name, true)
+		s.cancelPending(name, false)
+		s.forgetTransitions(name)
+	}
+	if len(joined) > 0 || len(left) > 0 {
+		s.refreshCoverage()
+		s.requestReconcile()
+	}
+}
+
+// watchTeam re-expands the team every TeamRefreshInterval
+func (s *Service) watchTeam(ctx context.Context) {
+	ticker := time.NewTicker(s.config.TeamRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshTeam()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+	"github.com/treybastian/twitchlinker/pkg/webhook"
+)
+
+// transition is the latest known stream transition of a channel. It lets
+// events that arrive out of order be recognised as stale.
+type transition struct {
+	Online bool      `json:"online"`
+	Type   string    `json:"type,omitempty"` // Stream type from stream.online, empty if unknown
+	At     time.Time `json:"at"`
+}
+
+// recordTransition records a transition for channelName unless a newer one is
+// already known, and reports whether it was recorded
+func (s *Service) recordTransition(channelName string, online bool, streamType string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, ok := s.transitions[channelName]; ok && !at.After(last.At) {
+		return false
+	}
+	s.transitions[channelName] = transition{Online: online, Type: streamType, At: at}
+	return true
+}
+
+// forgetTransitions drops what is known about a channel that is no longer monitored
+func (s *Service) forgetTransitions(channelName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.transitions, channelName)
+}
+
+// applyPolledTransitions reconciles a poll with the transitions from events,
+// using the stream start times in statuses. A channel Helix reports live is
+// considered offline if a stream.offline arrived after its stream started,
+// since Helix can lag behind EventSub. Otherwise its start time is recorded,
+// so that late events from an earlier stream are discarded. Channels Helix
+// doesn't report aren't recorded: Helix may not show a stream that just
+// started yet.
+//
+// Helix doesn't report stream types other than "live", so a channel also
+// stops counting as live when the stream.online of its current stream reported
+// a type that isn't in LiveStreamTypes.
+func (s *Service) applyPolledTransitions(isLive map[string]bool, statuses []twitch.ChannelStatus, polledAt time.Time) {
+	startedAt := make(map[string]time.Time)
+	for _, ch := range statuses {
+		if ch.Live && ch.StartedAt != nil {
+			startedAt[ch.Login] = *ch.StartedAt
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, live := range isLive {
+		if !live {
+			continue
+		}
+
+		at, ok := startedAt[name]
+		if !ok {
+			at = polledAt
+		}
+		last, known := s.transitions[name]
+		switch {
+		case known && !last.Online && !at.After(last.At):
+			log.Printf("Channel %s went offline at %s after its stream started, ignoring stale live status", name, last.At.Format(time.RFC3339))
+			isLive[name] = false
+		case !known || !last.Online:
+			s.transitions[name] = transition{Online: true, At: at}
+		case at.After(last.At):
+			// Helix's start time can differ slightly from the event's, so
+			// keep the type of the stream.online we already have
+			s.transitions[name] = transition{Online: true, Type: last.Type, At: at}
+		}
+
+		if t := s.transitions[name]; isLive[name] && !s.countsAsLive(t.Type) {
+			isLive[name] = false
+		}
+	}
+}
+
+// countsAsLive reports whether a stream of the given type counts as live. An
+// unknown type is what Helix reports, a regular live stream.
+func (s *Service) countsAsLive(streamType string) bool {
+	if streamType == "" {
+		streamType = webhook.StreamTypeLive
+	}
+	return slices.Contains(s.config.LiveStreamTypes, streamType)
+}
+
+// onlineEventTime is when a stream.online transition happened: when the stream
+// started, or when Twitch sent the event if it has no start time
+func onlineEventTime(startedAt, sentAt time.Time) time.Time {
+	if startedAt.IsZero() {
+		return sentAt
+	}
+	return startedAt
+}
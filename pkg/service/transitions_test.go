@@ -0,0 +1,257 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+	"github.com/treybastian/twitchlinker/pkg/webhook"
+)
+
+// newTransitionService returns a service with just enough state to track transitions
+func newTransitionService(liveStreamTypes ...string) *Service {
+	return &Service{
+		config:      &Config{LiveStreamTypes: liveStreamTypes},
+		transitions: make(map[string]transition),
+	}
+}
+
+var t0 = time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)
+
+func TestRecordTransition(t *testing.T) {
+	type event struct {
+		online     bool
+		streamType string
+		at         time.Time
+		recorded   bool
+	}
+
+	tests := []struct {
+		name   string
+		events []event
+		want   transition
+	}{
+		{
+			name: "in order",
+			events: []event{
+				{true, webhook.StreamTypeLive, t0, true},
+				{false, "", t0.Add(time.Hour), true},
+			},
+			want: transition{Online: false, At: t0.Add(time.Hour)},
+		},
+		{
+			name: "offline arrives before the online it follows",
+			events: []event{
+				{false, "", t0.Add(time.Hour), true},
+				{true, webhook.StreamTypeLive, t0, false},
+			},
+			want: transition{Online: false, At: t0.Add(time.Hour)},
+		},
+		{
+			name: "duplicate online",
+			events: []event{
+				{true, webhook.StreamTypeLive, t0, true},
+				{true, webhook.StreamTypeLive, t0, false},
+			},
+			want: transition{Online: true, Type: webhook.StreamTypeLive, At: t0},
+		},
+		{
+			name: "online and offline at the same time",
+			events: []event{
+				{true, webhook.StreamTypeLive, t0, true},
+				{false, "", t0, false},
+			},
+			want: transition{Online: true, Type: webhook.StreamTypeLive, At: t0},
+		},
+		{
+			name: "new stream after going offline",
+			events: []event{
+				{true, webhook.StreamTypeRerun, t0, true},
+				{false, "", t0.Add(time.Hour), true},
+				{true, webhook.StreamTypeLive, t0.Add(2 * time.Hour), true},
+			},
+			want: transition{Online: true, Type: webhook.StreamTypeLive, At: t0.Add(2 * time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTransitionService(webhook.StreamTypeLive)
+			for i, e := range tt.events {
+				if got := s.recordTransition("streamer", e.online, e.streamType, e.at); got != e.recorded {
+					t.Errorf("event %d: recorded = %t, want %t", i+1, got, e.recorded)
+				}
+			}
+			if got := s.transitions["streamer"]; got != tt.want {
+				t.Errorf("transition = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPolledTransitions(t *testing.T) {
+	polledAt := t0.Add(3 * time.Hour)
+	started := func(d time.Duration) *time.Time {
+		at := t0.Add(d)
+		return &at
+	}
+
+	tests := []struct {
+		name      string
+		known     *transition // Transition recorded from events before the poll
+		startedAt *time.Time  // Start time Helix reports, nil if it has none
+		live      bool        // Whether Helix reports the channel live
+		types     []string    // LiveStreamTypes, just "live" if empty
+		wantLive  bool
+		want      *transition // nil if no transition should be recorded
+	}{
+		{
+			name:      "first sighting records the start time",
+			startedAt: started(time.Hour),
+			live:      true,
+			wantLive:  true,
+			want:      &transition{Online: true, At: t0.Add(time.Hour)},
+		},
+		{
+			name:     "without a start time the poll time is used",
+			live:     true,
+			wantLive: true,
+			want:     &transition{Online: true, At: polledAt},
+		},
+		{
+			name:     "offline channel isn't recorded",
+			live:     false,
+			wantLive: false,
+		},
+		{
+			name:      "stream.offline after the stream started wins over a lagging poll",
+			known:     &transition{Online: false, At: t0.Add(2 * time.Hour)},
+			startedAt: started(time.Hour),
+			live:      true,
+			wantLive:  false,
+			want:      &transition{Online: false, At: t0.Add(2 * time.Hour)},
+		},
+		{
+			name:      "stream.offline exactly at the start still wins",
+			known:     &transition{Online: false, At: t0.Add(time.Hour)},
+			startedAt: started(time.Hour),
+			live:      true,
+			wantLive:  false,
+			want:      &transition{Online: false, At: t0.Add(time.Hour)},
+		},
+		{
+			name:      "stream started after the last stream.offline",
+			known:     &transition{Online: false, At: t0},
+			startedAt: started(time.Hour),
+			live:      true,
+			wantLive:  true,
+			want:      &transition{Online: true, At: t0.Add(time.Hour)},
+		},
+		{
+			name:      "Helix's later start time keeps the event's stream type",
+			known:     &transition{Online: true, Type: webhook.StreamTypeLive, At: t0.Add(time.Hour)},
+			startedAt: started(time.Hour + time.Second),
+			live:      true,
+			wantLive:  true,
+			want:      &transition{Online: true, Type: webhook.StreamTypeLive, At: t0.Add(time.Hour + time.Second)},
+		},
+		{
+			name:      "Helix's earlier start time doesn't replace the event",
+			known:     &transition{Online: true, Type: webhook.StreamTypeLive, At: t0.Add(time.Hour)},
+			startedAt: started(time.Hour - time.Second),
+			live:      true,
+			wantLive:  true,
+			want:      &transition{Online: true, Type: webhook.StreamTypeLive, At: t0.Add(time.Hour)},
+		},
+		{
+			name:      "filtered stream type doesn't count as live",
+			known:     &transition{Online: true, Type: webhook.StreamTypeRerun, At: t0.Add(time.Hour)},
+			startedAt: started(time.Hour),
+			live:      true,
+			wantLive:  false,
+			want:      &transition{Online: true, Type: webhook.StreamTypeRerun, At: t0.Add(time.Hour)},
+		},
+		{
+			name:      "allowed stream type counts as live",
+			known:     &transition{Online: true, Type: webhook.StreamTypeRerun, At: t0.Add(time.Hour)},
+			startedAt: started(time.Hour),
+			live:      true,
+			types:     []string{webhook.StreamTypeLive, webhook.StreamTypeRerun},
+			wantLive:  true,
+			want:      &transition{Online: true, Type: webhook.StreamTypeRerun, At: t0.Add(time.Hour)},
+		},
+		{
+			name:      "new stream after a filtered one is a regular live stream",
+			known:     &transition{Online: false, At: t0.Add(time.Hour)},
+			startedAt: started(2 * time.Hour),
+			live:      true,
+			wantLive:  true,
+			want:      &transition{Online: true, At: t0.Add(2 * time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types := tt.types
+			if len(types) == 0 {
+				types = []string{webhook.StreamTypeLive}
+			}
+			s := newTransitionService(types...)
+			if tt.known != nil {
+				s.transitions["streamer"] = *tt.known
+			}
+
+			isLive := map[string]bool{"streamer": tt.live}
+			statuses := []twitch.ChannelStatus{{Login: "streamer", Live: tt.live, StartedAt: tt.startedAt}}
+			s.applyPolledTransitions(isLive, statuses, polledAt)
+
+			if isLive["streamer"] != tt.wantLive {
+				t.Errorf("live = %t, want %t", isLive["streamer"], tt.wantLive)
+			}
+			got, ok := s.transitions["streamer"]
+			switch {
+			case tt.want == nil && ok:
+				t.Errorf("recorded %+v, want nothing", got)
+			case tt.want != nil && got != *tt.want:
+				t.Errorf("transition = %+v, want %+v", got, *tt.want)
+			}
+		})
+	}
+}
+
+// A poll that sees a new stream and a late stream.offline for the previous
+// one can be handled in either order
+func TestPollRacingWebhook(t *testing.T) {
+	started := t0.Add(time.Hour)
+	lateOffline := t0.Add(30 * time.Minute) // When Twitch sent the offline of the previous stream
+	statuses := []twitch.ChannelStatus{{Login: "streamer", Live: true, StartedAt: &started}}
+
+	t.Run("poll first", func(t *testing.T) {
+		s := newTransitionService(webhook.StreamTypeLive)
+
+		isLive := map[string]bool{"streamer": true}
+		s.applyPolledTransitions(isLive, statuses, t0.Add(2*time.Hour))
+		if !isLive["streamer"] {
+			t.Fatal("poll didn't count the new stream as live")
+		}
+		if s.recordTransition("streamer", false, "", lateOffline) {
+			t.Error("late stream.offline was recorded over the newer stream")
+		}
+	})
+
+	t.Run("webhook first", func(t *testing.T) {
+		s := newTransitionService(webhook.StreamTypeLive)
+
+		if !s.recordTransition("streamer", false, "", lateOffline) {
+			t.Fatal("stream.offline wasn't recorded")
+		}
+		isLive := map[string]bool{"streamer": true}
+		s.applyPolledTransitions(isLive, statuses, t0.Add(2*time.Hour))
+		if !isLive["streamer"] {
+			t.Error("poll didn't count the new stream as live")
+		}
+		if got := s.transitions["streamer"]; !got.Online || !got.At.Equal(started) {
+			t.Errorf("transition = %+v, want online at %s", got, started)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/twitch"
+)
+
+// scheduleCacheAge is how long a channel's Twitch schedule is cached
+const scheduleCacheAge = 15 * time.Minute
+
+// upcomingTemplateData is what UPCOMING_URL_TEMPLATE is rendered with
+type upcomingTemplateData struct {
+	Channel    string
+	ChannelURL string
+	Title      string
+	Category   string
+	Start      time.Time
+	StartUnix  int64
+}
+
+// decideUpcoming picks the highest priority channel whose next scheduled
+// stream starts within UpcomingWindow. It also arms a timer for the moment the
+// next known stream enters the window, so the redirect changes on time.
+func (s *Service) decideUpcoming() (decision, bool) {
+	now := time.Now()
+	var chosen decision
+	var found bool
+	var nextEntry time.Time
+
+	for _, name := range s.twitchClient.GetChannelNames() {
+		segment, err := s.twitchClient.GetNextSegment(name, scheduleCacheAge)
+		if err != nil {
+			log.Printf("Warning: Failed to get schedule for channel %s: %v", name, err)
+			continue
+		}
+		if segment == nil {
+			continue
+		}
+
+		entry := segment.Start.Add(-s.config.UpcomingWindow)
+		if entry.After(now) {
+			if nextEntry.IsZero() || entry.Before(nextEntry) {
+				nextEntry = entry
+			}
+			continue
+		}
+
+		if !found {
+			chosen = decision{Target: s.upcomingURL(name, segment), Upcoming: name, Reason: reasonUpcoming}
+			found = true
+		}
+	}
+
+	// Don't look further ahead than the schedule cache, it may change by then
+	if !nextEntry.IsZero() && nextEntry.Before(now.Add(scheduleCacheAge)) {
+		s.mu.Lock()
+		if s.upcomingTimer != nil {
+			s.upcomingTimer.Stop()
+		}
+		s.upcomingTimer = time.AfterFunc(time.Until(nextEntry), s.requestReconcile)
+		s.mu.Unlock()
+	}
+
+	return chosen, found
+}
+
+// upcomingURL renders UPCOMING_URL_TEMPLATE for a channel's next stream, or
+// returns the channel page if no template is configured or it fails
+func (s *Service) upcomingURL(channelName string, segment *twitch.ScheduleSegment) string {
+	channelURL := s.twitchClient.GetChannelURL(channelName)
+	if s.upcomingTemplate == nil {
+		return channelURL
+	}
+
+	var b strings.Builder
+	err := s.upcomingTemplate.Execute(&b, upcomingTemplateData{
+		Channel:    channelName,
+		ChannelURL: channelURL,
+		Title:      segment.Title,
+		Category:   segment.Category,
+		Start:      segment.Start,
+		StartUnix:  segment.Start.Unix(),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to render upcoming URL template: %v", err)
+		return channelURL
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"log"
+	"time"
+)
+
+// videoCacheAge is how long a channel's latest video is cached. The cache is
+// also dropped when the channel goes offline, since its archive changes then.
+const videoCacheAge = time.Hour
+
+// Video types that can be used as the offline fallback
+var videoTypes = map[string]bool{"archive": true, "highlight": true, "upload": true}
+
+// videoType returns the kind of video used as the fallback for a channel, or
+// an empty string if the channel's videos aren't used
+func (s *Service) videoType(channelName string) string {
+	if t, ok := s.config.VODFallbackChannels[channelName]; ok {
+		if t == "none" {
+			return ""
+		}
+		return t
+	}
+	return s.config.VODFallback
+}
+
+// decideVOD picks the most recent video of the highest priority channel that
+// has one of its configured type
+func (s *Service) decideVOD() (decision, bool) {
+	for _, name := range s.twitchClient.GetChannelNames() {
+		videoType := s.videoType(name)
+		if videoType == "" {
+			continue
+		}
+
+		video, err := s.twitchClient.GetLatestVideo(name, videoType, videoCacheAge)
+		if err != nil {
+			log.Printf("Warning: Failed to get videos for channel %s: %v", name, err)
+			continue
+		}
+		if video != nil {
+			return decision{Target: video.URL, Video: video, VideoChannel: name, Reason: reasonVOD}, true
+		}
+	}
+	return decision{}, false
+}
+
+// vodFallbackEnabled reports whether any channel's videos are used as the fallback
+func (s *Service) vodFallbackEnabled() bool {
+	if s.config.VODFallback != "" {
+		return true
+	}
+	for _, videoType := range s.config.VODFallbackChannels {
+		if videoType != "none" {
+			return true
+		}
+	}
+	return false
+}
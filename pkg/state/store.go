@@ -0,0 +1,106 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is everything the service needs to pick up where it left off after a restart
+type State struct {
+	LiveChannel   string                       `json:"live_channel,omitempty"`
+	LiveSince     time.Time                    `json:"live_since,omitempty"`
+	Pending       map[string]PendingTransition `json:"pending,omitempty"`
+	Subscriptions map[string][]string          `json:"subscriptions,omitempty"` // Maps channel names to EventSub subscription IDs
+	AccessToken   string                       `json:"access_token,omitempty"`
+	TokenExpiry   time.Time                    `json:"token_expiry,omitempty"`
+
+	// Runtime changes made through the admin API, applied on top of the environment configuration
+	AddedChannels   []string `json:"added_channels,omitempty"`
+	RemovedChannels []string `json:"removed_channels,omitempty"`
+	DefaultURL      *string  `json:"default_url,omitempty"`
+	WebhookSecret   string   `json:"webhook_secret,omitempty"` // Set by a secret rotation, replaces WEBHOOK_SECRET for new subscriptions
+
+	Override *Override `json:"override,omitempty"`
+}
+
+// Override pins the redirect to a URL regardless of stream status
+type Override struct {
+	URL       string    `json:"url"`
+	SetBy     string    `json:"set_by"`
+	Reason    string    `json:"reason,omitempty"`
+	SetAt     time.Time `json:"set_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // Zero means until cleared
+}
+
+// PendingTransition is a debounced stream event that had not been applied yet
+type PendingTransition struct {
+	Online   bool      `json:"online"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// Store reads and writes State as a JSON file
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load reads the state file. A missing file is not an error and returns an empty State.
+func (s *Store) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return &st, nil
+}
+
+// Save writes the state file atomically so a crash mid-write never leaves a
+// truncated file behind. The file holds an access token, so it is only
+// readable by the owner.
+func (s *Store) Save(st *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
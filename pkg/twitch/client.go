@@ -2,185 +2,303 @@ package twitch
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/nicklaw5/helix/v2"
 )
 
 type Client struct {
-	helixClient  *helix.Client
+	helixClient *helix.Client
+	httpClient  *authHTTPClient // For endpoints the helix library doesn't cover
+	clientID    string
+
+	mu           sync.RWMutex // Guards the channel fields below
 	channelNames []string
-	channelIDs   map[string]string // Maps channel names to their IDs
-	streamURLs   map[string]string // Maps channel names to their stream URLs
+	channelIDs   map[string]string       // Maps channel names to their IDs
+	streamURLs   map[string]string       // Maps channel names to their stream URLs
+	liveStreams  map[string]helix.Stream // Live streams from the last GetLiveChannels, keyed by channel name
+	schedules    map[string]cachedSchedule
+	videos       map[string]cachedVideo // Keyed by "channel:type"
+	teamName     string
+	teamPriority []string
+	teamMembers  map[string]bool // Channels monitored only because they are in the team
+
+	subscriptions map[string][]subscription // Maps channel names to their EventSub subscriptions
+	appToken      string
+	tokenExpiry   time.Time
 }
 
+// helixMaxIDs is the most logins or user IDs Helix accepts in one request
+const helixMaxIDs = 100
+
+// tokenRefreshMargin is how much life a stored app access token must have
+// left to be reused instead of requesting a new one. Tokens in use are renewed
+// once they have less than this left.
+const tokenRefreshMargin = time.Hour
+
 func NewClient(clientID, clientSecret string, channelNames []string) (*Client, error) {
+	httpClient := &authHTTPClient{next: &instrumentedHTTPClient{client: http.DefaultClient}}
 	client, err := helix.NewClient(&helix.Options{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
+		HTTPClient:   httpClient,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		helixClient:  client,
-		channelNames: channelNames,
-		channelIDs:   make(map[string]string),
-		streamURLs:   make(map[string]string),
-	}, nil
+	// Twitch logins are always lowercase, so normalize to match event payloads
+	logins := make([]string, len(channelNames))
+	for i, name := range channelNames {
+		logins[i] = strings.ToLower(name)
+	}
+
+	c := &Client{
+		helixClient:   client,
+		httpClient:    httpClient,
+		clientID:      clientID,
+		channelNames:  logins,
+		channelIDs:    make(map[string]string),
+		streamURLs:    make(map[string]string),
+		liveStreams:   make(map[string]helix.Stream),
+		schedules:     make(map[string]cachedSchedule),
+		videos:        make(map[string]cachedVideo),
+		teamMembers:   make(map[string]bool),
+		subscriptions: make(map[string][]subscription),
+	}
+	httpClient.client = c
+	return c, nil
 }
 
 func (c *Client) Initialize() error {
-	// Get app access token
-	resp, err := c.helixClient.RequestAppAccessToken([]string{})
-	if err != nil {
+	c.mu.RLock()
+	appToken, tokenExpiry := c.appToken, c.tokenExpiry
+	c.mu.RUnlock()
+
+	// A stored token may have been revoked, or issued for a different client
+	// secret, so it is only reused once Twitch confirms it
+	if appToken != "" && time.Until(tokenExpiry) > tokenRefreshMargin && c.validateAppAccessToken(appToken) {
+		_, tokenExpiry = c.GetAppAccessToken()
+		log.Printf("Reusing stored app access token (expires %s)", tokenExpiry.Format(time.RFC3339))
+		c.helixClient.SetAppAccessToken(appToken)
+	} else if err := c.requestAppAccessToken(); err != nil {
 		return err
 	}
-	c.helixClient.SetAppAccessToken(resp.Data.AccessToken)
-	
-	// Get user IDs for all channels
-	users, err := c.helixClient.GetUsers(&helix.UsersParams{
-		Logins: c.channelNames,
-	})
-	if err != nil {
-		return err
+
+	// Channels may all come from a team, which RefreshTeam resolves
+	if len(c.channelNames) == 0 {
+		return nil
 	}
-	
+
+	// Get user IDs for all channels, in batches Helix accepts
+	var found []helix.User
+	for _, logins := range batches(c.channelNames, helixMaxIDs) {
+		users, err := c.helixClient.GetUsers(&helix.UsersParams{
+			Logins: logins,
+		})
+		if err != nil {
+			return err
+		}
+		found = append(found, users.Data.Users...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Store user IDs and stream URLs
-	for _, user := range users.Data.Users {
+	for _, user := range found {
 		c.channelIDs[user.Login] = user.ID
 		c.streamURLs[user.Login] = "https://twitch.tv/" + user.Login
 		log.Printf("Initialized channel %s with ID %s", user.Login, user.ID)
 	}
-	
+
 	// Check if any channels weren't found
-	if len(users.Data.Users) < len(c.channelNames) {
+	if len(found) < len(c.channelNames) {
 		// Log warning for channels not found
 		foundChannels := make(map[string]bool)
-		for _, user := range users.Data.Users {
+		for _, user := range found {
 			foundChannels[user.Login] = true
 		}
-		
+
 		for _, channel := range c.channelNames {
 			if !foundChannels[channel] {
 				log.Printf("Warning: Channel not found: %s", channel)
 			}
 		}
 	}
-	
+
 	return nil
 }
 
-func (c *Client) IsStreamLive() (bool, string, error) {
-	if len(c.channelIDs) == 0 {
-		return false, "", errors.New("no channels initialized")
+// ErrChannelNotFound is returned when a channel login does not resolve to a Twitch user
+var ErrChannelNotFound = errors.New("channel not found")
+
+// AddChannel resolves a channel and starts monitoring it after the other
+// channels monitored by name. Adding a channel that is already monitored is a no-op.
+func (c *Client) AddChannel(channelName string) error {
+	channelName = strings.ToLower(channelName)
+
+	c.mu.RLock()
+	_, exists := c.channelIDs[channelName]
+	c.mu.RUnlock()
+	if exists {
+		return nil
 	}
-	
-	// Get all user IDs
-	var userIDs []string
-	for _, id := range c.channelIDs {
-		userIDs = append(userIDs, id)
+
+	users, err := c.helixClient.GetUsers(&helix.UsersParams{
+		Logins: []string{channelName},
+	})
+	if err != nil {
+		return err
+	}
+	if len(users.Data.Users) == 0 {
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, channelName)
+	}
+	user := users.Data.Users[0]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !slices.Contains(c.channelNames, user.Login) {
+		c.channelNames = append(c.channelNames, user.Login)
 	}
-	
-	// Check if any stream is live
-	streams, err := c.helixClient.GetStreams(&helix.StreamsParams{
-		UserIDs: userIDs,
-		First:   100, // Maximum number of results
+	c.channelIDs[user.Login] = user.ID
+	c.streamURLs[user.Login] = "https://twitch.tv/" + user.Login
+	c.sortTeamLocked()
+	log.Printf("Initialized channel %s with ID %s", user.Login, user.ID)
+	return nil
+}
+
+// RemoveChannel stops monitoring a channel and deletes its EventSub subscriptions
+func (c *Client) RemoveChannel(channelName string) error {
+	channelName = strings.ToLower(channelName)
+
+	if err := c.deleteChannelSubscriptions(channelName); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.channelNames = slices.DeleteFunc(c.channelNames, func(name string) bool {
+		return name == channelName
 	})
+	delete(c.channelIDs, channelName)
+	delete(c.streamURLs, channelName)
+	delete(c.liveStreams, channelName)
+	delete(c.schedules, channelName)
+	delete(c.teamMembers, channelName)
+	c.invalidateVideosLocked(channelName)
+	delete(c.subscriptions, channelName)
+	log.Printf("Removed channel %s", channelName)
+	return nil
+}
+
+// SetChannelNames replaces the list of channels to monitor. Call it before
+// Initialize; use AddChannel and RemoveChannel afterwards.
+func (c *Client) SetChannelNames(channelNames []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.channelNames = make([]string, len(channelNames))
+	for i, name := range channelNames {
+		c.channelNames[i] = strings.ToLower(name)
+	}
+}
+
+// IsStreamLive reports whether any monitored channel is live and returns the
+// stream URL of the highest priority live channel
+func (c *Client) IsStreamLive() (bool, string, error) {
+	liveChannels, err := c.GetLiveChannels()
 	if err != nil {
 		return false, "", err
 	}
-	
+
 	// No streams are live
-	if len(streams.Data.Streams) == 0 {
+	if len(liveChannels) == 0 {
 		return false, "", nil
 	}
-	
-	// Get the first live stream (we can prioritize streams later if needed)
-	liveStream := streams.Data.Streams[0]
-	
-	// Find the channel name from user ID
-	var liveChannelName string
+
+	return true, c.GetChannelURL(liveChannels[0]), nil
+}
+
+// GetLiveChannels returns the names of all live channels in priority order
+func (c *Client) GetLiveChannels() ([]string, error) {
+	c.mu.RLock()
+	channelNames := append([]string(nil), c.channelNames...)
+	channelIDs := make(map[string]string, len(c.channelIDs))
 	for name, id := range c.channelIDs {
-		if id == liveStream.UserID {
-			liveChannelName = name
-			break
-		}
+		channelIDs[name] = id
 	}
-	
-	if liveChannelName == "" {
-		return false, "", errors.New("couldn't map live stream to a channel name")
-	}
-	
-	streamURL := c.streamURLs[liveChannelName]
-	log.Printf("Channel %s is live", liveChannelName)
-	
-	return true, streamURL, nil
-}
-
-func (c *Client) SubscribeToStreamStatus(callbackURL, secret string) error {
-	if len(c.channelIDs) == 0 {
-		return errors.New("no channels initialized")
-	}
-
-	// Subscribe to all channels
-	for channelName, userID := range c.channelIDs {
-		// Create EventSub subscription for stream.online events
-		onlineResp, err := c.helixClient.CreateEventSubSubscription(&helix.EventSubSubscription{
-			Type:    "stream.online",
-			Version: "1",
-			Condition: helix.EventSubCondition{
-				BroadcasterUserID: userID,
-			},
-			Transport: helix.EventSubTransport{
-				Method:   "webhook",
-				Callback: callbackURL,
-				Secret:   secret,
-			},
-		})
+	c.mu.RUnlock()
 
-		if err != nil {
-			log.Printf("Error subscribing to stream.online events for channel %s: %v", channelName, err)
-			continue
-		}
+	if len(channelIDs) == 0 {
+		return nil, errors.New("no channels initialized")
+	}
 
-		if onlineResp.StatusCode != 202 {
-			log.Printf("EventSub subscription failed with status code: %d for channel %s", onlineResp.StatusCode, channelName)
-			continue
-		}
+	// Get all user IDs
+	var userIDs []string
+	for _, id := range channelIDs {
+		userIDs = append(userIDs, id)
+	}
 
-		log.Printf("Successfully subscribed to stream.online events for channel %s", channelName)
-		
-		// Create EventSub subscription for stream.offline events
-		offlineResp, err := c.helixClient.CreateEventSubSubscription(&helix.EventSubSubscription{
-			Type:    "stream.offline",
-			Version: "1",
-			Condition: helix.EventSubCondition{
-				BroadcasterUserID: userID,
-			},
-			Transport: helix.EventSubTransport{
-				Method:   "webhook",
-				Callback: callbackURL,
-				Secret:   secret,
-			},
+	// Check if any stream is live, in batches Helix accepts
+	liveByID := make(map[string]helix.Stream)
+	for _, ids := range batches(userIDs, helixMaxIDs) {
+		streams, err := c.helixClient.GetStreams(&helix.StreamsParams{
+			UserIDs: ids,
+			First:   helixMaxIDs,
 		})
-
 		if err != nil {
-			log.Printf("Error subscribing to stream.offline events for channel %s: %v", channelName, err)
-			continue
+			return nil, err
+		}
+		for _, stream := range streams.Data.Streams {
+			liveByID[stream.UserID] = stream
 		}
+	}
 
-		if offlineResp.StatusCode != 202 {
-			log.Printf("EventSub subscription failed with status code: %d for channel %s", offlineResp.StatusCode, channelName)
+	// Channels are prioritized in the order they were configured
+	var liveChannels []string
+	liveStreams := make(map[string]helix.Stream)
+	for _, name := range channelNames {
+		id, ok := channelIDs[name]
+		if !ok {
 			continue
 		}
-
-		log.Printf("Successfully subscribed to stream.offline events for channel %s", channelName)
+		if stream, ok := liveByID[id]; ok {
+			log.Printf("Channel %s is live", name)
+			liveChannels = append(liveChannels, name)
+			liveStreams[name] = stream
+		}
 	}
 
-	return nil
+	c.mu.Lock()
+	c.liveStreams = liveStreams
+	c.mu.Unlock()
+
+	return liveChannels, nil
+}
+
+// GetAppAccessToken returns the current app access token and when it expires
+func (c *Client) GetAppAccessToken() (string, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.appToken, c.tokenExpiry
+}
+
+// SetAppAccessToken restores an app access token from a previous run. Call it
+// before Initialize; the token is reused if it is not close to expiring.
+func (c *Client) SetAppAccessToken(token string, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.appToken, c.tokenExpiry = token, expiry
 }
 
 // GetStreamURL returns the URL for the first live channel or empty string if none are live
@@ -192,7 +310,77 @@ func (c *Client) GetStreamURL() string {
 	return url
 }
 
-// GetChannelNames returns all tracked channel names
+// ChannelStatus describes a monitored channel as of the last GetLiveChannels call
+type ChannelStatus struct {
+	ID        string     `json:"id"`
+	Login     string     `json:"login"`
+	Live      bool       `json:"live"`
+	Title     string     `json:"title,omitempty"`
+	Game      string     `json:"game,omitempty"`
+	Viewers   int        `json:"viewers"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Team      bool       `json:"team,omitempty"` // Monitored because it is in the team
+
+	ThumbnailURL string `json:"thumbnail_url,omitempty"` // Preview of the live stream
+}
+
+// GetChannelStatuses returns the status of every monitored channel in priority order
+func (c *Client) GetChannelStatuses() []ChannelStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make([]ChannelStatus, 0, len(c.channelNames))
+	for _, name := range c.channelNames {
+		status := ChannelStatus{ID: c.channelIDs[name], Login: name, Team: c.teamMembers[name]}
+		if stream, ok := c.liveStreams[name]; ok {
+			startedAt := stream.StartedAt
+			status.Live = true
+			status.Title = stream.Title
+			status.Game = stream.GameName
+			status.Viewers = stream.ViewerCount
+			status.StartedAt = &startedAt
+			status.ThumbnailURL = strings.NewReplacer("{width}", "1280", "{height}", "720").Replace(stream.ThumbnailURL)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// GetChannelIDs returns the user IDs of all channels that were resolved
+func (c *Client) GetChannelIDs() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make(map[string]string, len(c.channelIDs))
+	for name, id := range c.channelIDs {
+		ids[name] = id
+	}
+	return ids
+}
+
+// GetChannelURL returns the stream URL for a channel
+func (c *Client) GetChannelURL(channelName string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.streamURLs[channelName]
+}
+
+// GetChannelNames returns all tracked channel names in priority order
 func (c *Client) GetChannelNames() []string {
-	return c.channelNames
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.channelNames...)
+}
+
+// batches splits items into consecutive slices of at most size items
+func batches(items []string, size int) [][]string {
+	var out [][]string
+	for len(items) > size {
+		out = append(out, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		out = append(out, items)
+	}
+	return out
 }
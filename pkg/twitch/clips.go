@@ -0,0 +1,60 @@
+package twitch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// Clip is a clip of one of the monitored channels
+type Clip struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Creator   string    `json:"creator"`
+	Views     int       `json:"views"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetTopClip returns the most viewed clip of a channel created since the
+// given time with at least minViews views, or nil if there is none
+func (c *Client) GetTopClip(channelName string, since time.Time, minViews int) (*Clip, error) {
+	c.mu.RLock()
+	userID, ok := c.channelIDs[channelName]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("channel %s is not initialized", channelName)
+	}
+
+	// Twitch rejects timestamps with fractional seconds
+	resp, err := c.helixClient.GetClips(&helix.ClipsParams{
+		BroadcasterID: userID,
+		First:         1,
+		StartedAt:     helix.Time{Time: since.UTC().Truncate(time.Second)},
+		EndedAt:       helix.Time{Time: time.Now().UTC().Truncate(time.Second)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("getting clips failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+	}
+
+	// Clips come back sorted by view count, so only the first can qualify
+	if len(resp.Data.Clips) == 0 || resp.Data.Clips[0].ViewCount < minViews {
+		return nil, nil
+	}
+
+	clip := resp.Data.Clips[0]
+	createdAt, _ := time.Parse(time.RFC3339, clip.CreatedAt)
+	return &Clip{
+		ID:        clip.ID,
+		Title:     clip.Title,
+		URL:       clip.URL,
+		Creator:   clip.CreatorName,
+		Views:     clip.ViewCount,
+		CreatedAt: createdAt,
+	}, nil
+}
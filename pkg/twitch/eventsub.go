@@ -0,0 +1,519 @@
+package twitch
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// streamEventTypes are the EventSub subscription types created for every channel
+var streamEventTypes = []string{"stream.online", "stream.offline"}
+
+// subscription is an EventSub subscription we created. Type and Status are
+// empty for subscriptions restored from a previous run until they are refreshed.
+type subscription struct {
+	ID     string
+	Type   string
+	Status string
+}
+
+// SubscribeToStreamStatus subscribes every channel to stream.online and
+// stream.offline events, reusing subscriptions Twitch still has active. It
+// returns an error naming the channels that could not be fully subscribed.
+func (c *Client) SubscribeToStreamStatus(callbackURL, secret string) error {
+	c.mu.RLock()
+	channelIDs := make(map[string]string, len(c.channelIDs))
+	for name, id := range c.channelIDs {
+		channelIDs[name] = id
+	}
+	c.mu.RUnlock()
+
+	if len(channelIDs) == 0 {
+		return errors.New("no channels initialized")
+	}
+
+	// Reuse subscriptions restored from a previous run if Twitch still has
+	// them, and adopt ones created by an earlier run that left no state
+	if err := c.RefreshSubscriptions(); err != nil {
+		log.Printf("Warning: Could not verify stored EventSub subscriptions: %v", err)
+	}
+	if err := c.adoptSubscriptions(callbackURL); err != nil {
+		log.Printf("Warning: Could not look for existing EventSub subscriptions: %v", err)
+	}
+
+	// Subscribe to all channels
+	var failed []string
+	for channelName, userID := range channelIDs {
+		if err := c.subscribeChannel(channelName, userID, callbackURL, secret); err != nil {
+			failed = append(failed, channelName)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to subscribe to stream events for channels: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// SubscribeChannel subscribes a single resolved channel to stream events
+func (c *Client) SubscribeChannel(channelName, callbackURL, secret string) error {
+	c.mu.RLock()
+	userID, ok := c.channelIDs[channelName]
+	c.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("channel %s is not initialized", channelName)
+	}
+	return c.subscribeChannel(channelName, userID, callbackURL, secret)
+}
+
+// verifyPollInterval is how often ResubscribeChannels checks whether Twitch
+// has verified the new subscriptions
+const verifyPollInterval = 2 * time.Second
+
+// ResubscribeChannels moves channels to subscriptions signed with a new secret
+// without a gap in coverage. New subscriptions are created next to the old
+// ones, and a channel's old subscriptions are only deleted once all of its new
+// ones are enabled. Twitch rejects a second subscription of the same type,
+// condition and callback, so callbackURL must differ from the old one.
+//
+// Channels whose new subscriptions could not be created or weren't verified
+// within timeout keep their old subscriptions and are returned with the error.
+func (c *Client) ResubscribeChannels(channelNames []string, callbackURL, secret string, timeout time.Duration) map[string]error {
+	failed := make(map[string]error)
+	oldIDs := c.GetSubscriptions()
+	newIDs := make(map[string][]string)
+
+	for _, channelName := range channelNames {
+		ids, err := c.createChannelSubscriptions(channelName, callbackURL, secret)
+		if err != nil {
+			failed[channelName] = err
+			continue
+		}
+		newIDs[channelName] = ids
+	}
+
+	// Twitch verifies new subscriptions by sending a challenge to the callback
+	deadline := time.Now().Add(timeout)
+	for len(newIDs) > 0 {
+		if err := c.RefreshSubscriptions(); err != nil {
+			log.Printf("Warning: Failed to check new EventSub subscriptions: %v", err)
+		}
+
+		pending := false
+		for channelName, ids := range newIDs {
+			switch c.subscriptionsStatus(ids) {
+			case helix.EventSubStatusEnabled:
+				for _, id := range oldIDs[channelName] {
+					if err := c.DeleteSubscription(id); err != nil {
+						// Both subscriptions deliver until this is retried, which is harmless
+						log.Printf("Warning: Failed to delete old subscription %s for channel %s: %v", id, channelName, err)
+					}
+				}
+				log.Printf("Channel %s switched to its new EventSub subscriptions", channelName)
+				delete(newIDs, channelName)
+			case helix.EventSubStatusPending:
+				pending = true
+			default:
+				failed[channelName] = errors.New("new subscriptions failed verification")
+				c.deleteSubscriptionIDs(channelName, ids)
+				delete(newIDs, channelName)
+			}
+		}
+
+		if !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			for channelName, ids := range newIDs {
+				failed[channelName] = errors.New("new subscriptions were not verified in time")
+				c.deleteSubscriptionIDs(channelName, ids)
+			}
+			break
+		}
+		time.Sleep(verifyPollInterval)
+	}
+
+	return failed
+}
+
+// createChannelSubscriptions creates a full set of stream event subscriptions
+// for a channel, next to any it already has, and returns their IDs. If any
+// can't be created, the ones that were are deleted again.
+func (c *Client) createChannelSubscriptions(channelName, callbackURL, secret string) ([]string, error) {
+	c.mu.RLock()
+	userID, ok := c.channelIDs[channelName]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("channel %s is not initialized", channelName)
+	}
+
+	var ids []string
+	for _, eventType := range streamEventTypes {
+		sub, err := c.createSubscription(userID, eventType, callbackURL, secret)
+		if err != nil {
+			c.deleteSubscriptionIDs(channelName, ids)
+			return nil, fmt.Errorf("%s: %w", eventType, err)
+		}
+
+		c.mu.Lock()
+		c.subscriptions[channelName] = append(c.subscriptions[channelName], sub)
+		c.mu.Unlock()
+		ids = append(ids, sub.ID)
+	}
+	return ids, nil
+}
+
+// subscriptionsStatus returns helix.EventSubStatusEnabled if every subscription
+// is enabled, helix.EventSubStatusPending if none has failed yet, and an empty
+// status if any is gone or has failed
+func (c *Client) subscriptionsStatus(ids []string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := make(map[string]string)
+	for _, known := range c.subscriptions {
+		for _, sub := range known {
+			status[sub.ID] = sub.Status
+		}
+	}
+
+	result := helix.EventSubStatusEnabled
+	for _, id := range ids {
+		switch status[id] {
+		case helix.EventSubStatusEnabled:
+		case helix.EventSubStatusPending:
+			result = helix.EventSubStatusPending
+		default:
+			return ""
+		}
+	}
+	return result
+}
+
+// deleteSubscriptionIDs deletes subscriptions of a channel, logging failures
+func (c *Client) deleteSubscriptionIDs(channelName string, ids []string) {
+	for _, id := range ids {
+		if err := c.DeleteSubscription(id); err != nil {
+			log.Printf("Warning: Failed to delete subscription %s for channel %s: %v", id, channelName, err)
+		}
+	}
+}
+
+// subscribeChannel creates any missing stream event subscriptions for a channel
+func (c *Client) subscribeChannel(channelName, userID, callbackURL, secret string) error {
+	var errs []error
+	for _, eventType := range streamEventTypes {
+		if c.hasSubscription(channelName, eventType) {
+			log.Printf("Reusing existing %s subscription for channel %s", eventType, channelName)
+			continue
+		}
+
+		sub, err := c.createSubscription(userID, eventType, callbackURL, secret)
+		if errors.Is(err, errSubscriptionExists) {
+			// Created by an earlier run we have no record of
+			if adoptErr := c.adoptSubscriptions(callbackURL); adoptErr != nil {
+				log.Printf("Warning: Could not look for existing EventSub subscriptions: %v", adoptErr)
+			}
+			if c.hasSubscription(channelName, eventType) {
+				continue
+			}
+		}
+		if err != nil {
+			log.Printf("Error subscribing to %s events for channel %s: %v", eventType, channelName, err)
+			errs = append(errs, fmt.Errorf("%s: %w", eventType, err))
+			continue
+		}
+
+		c.mu.Lock()
+		c.subscriptions[channelName] = append(c.subscriptions[channelName], sub)
+		c.mu.Unlock()
+		log.Printf("Successfully subscribed to %s events for channel %s", eventType, channelName)
+	}
+	return errors.Join(errs...)
+}
+
+// createSubscription creates a webhook EventSub subscription
+func (c *Client) createSubscription(userID, eventType, callbackURL, secret string) (subscription, error) {
+	resp, err := c.helixClient.CreateEventSubSubscription(&helix.EventSubSubscription{
+		Type:    eventType,
+		Version: "1",
+		Condition: helix.EventSubCondition{
+			BroadcasterUserID: userID,
+		},
+		Transport: helix.EventSubTransport{
+			Method:   "webhook",
+			Callback: callbackURL,
+			Secret:   secret,
+		},
+	})
+	if err != nil {
+		return subscription{}, err
+	}
+
+	if resp.StatusCode == http.StatusConflict {
+		return subscription{}, errSubscriptionExists
+	}
+	if resp.StatusCode != 202 {
+		return subscription{}, fmt.Errorf("EventSub subscription failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+	}
+	if len(resp.Data.EventSubSubscriptions) == 0 {
+		return subscription{}, errors.New("EventSub subscription response contained no subscription")
+	}
+
+	sub := resp.Data.EventSubSubscriptions[0]
+	return subscription{ID: sub.ID, Type: sub.Type, Status: sub.Status}, nil
+}
+
+// errSubscriptionExists is returned when Twitch already has a subscription of
+// the same type, condition and callback
+var errSubscriptionExists = errors.New("EventSub subscription already exists")
+
+// adoptSubscriptions starts tracking enabled or pending subscriptions Twitch
+// has for our channels and callback that we have no record of, such as ones
+// created by a run without a state file
+func (c *Client) adoptSubscriptions(callbackURL string) error {
+	subs, err := c.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	known := make(map[string]bool)
+	for _, tracked := range c.subscriptions {
+		for _, sub := range tracked {
+			known[sub.ID] = true
+		}
+	}
+	channelNames := make(map[string]string, len(c.channelIDs))
+	for name, id := range c.channelIDs {
+		channelNames[id] = name
+	}
+
+	for _, sub := range subs {
+		channelName, ours := channelNames[sub.Condition.BroadcasterUserID]
+		if !ours || known[sub.ID] || sub.Transport.Callback != callbackURL || !slices.Contains(streamEventTypes, sub.Type) {
+			continue
+		}
+		if sub.Status != helix.EventSubStatusEnabled && sub.Status != helix.EventSubStatusPending {
+			continue
+		}
+		c.subscriptions[channelName] = append(c.subscriptions[channelName], subscription{ID: sub.ID, Type: sub.Type, Status: sub.Status})
+		log.Printf("Adopted existing %s subscription %s for channel %s", sub.Type, sub.ID, channelName)
+	}
+	return nil
+}
+
+// hasSubscription reports whether channelName has an enabled or pending
+// subscription of the given type
+func (c *Client) hasSubscription(channelName, eventType string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, sub := range c.subscriptions[channelName] {
+		if sub.Type == eventType && (sub.Status == helix.EventSubStatusEnabled || sub.Status == helix.EventSubStatusPending) {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshSubscriptions updates the status of our subscriptions from Twitch
+// and drops the ones that no longer exist or have failed
+func (c *Client) RefreshSubscriptions() error {
+	subs, err := c.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]helix.EventSubSubscription, len(subs))
+	for _, sub := range subs {
+		current[sub.ID] = sub
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for channelName, known := range c.subscriptions {
+		var kept []subscription
+		for _, sub := range known {
+			latest, ok := current[sub.ID]
+			if !ok {
+				log.Printf("EventSub subscription %s for channel %s no longer exists", sub.ID, channelName)
+				continue
+			}
+			if latest.Status != helix.EventSubStatusEnabled && latest.Status != helix.EventSubStatusPending {
+				log.Printf("EventSub subscription %s for channel %s is %s", sub.ID, channelName, latest.Status)
+				continue
+			}
+			kept = append(kept, subscription{ID: latest.ID, Type: latest.Type, Status: latest.Status})
+		}
+
+		if len(kept) == 0 {
+			delete(c.subscriptions, channelName)
+		} else {
+			c.subscriptions[channelName] = kept
+		}
+	}
+
+	return nil
+}
+
+// ListSubscriptions returns every EventSub subscription owned by this client ID
+func (c *Client) ListSubscriptions() ([]helix.EventSubSubscription, error) {
+	var subs []helix.EventSubSubscription
+	params := &helix.EventSubSubscriptionsParams{}
+
+	for {
+		resp, err := c.helixClient.GetEventSubSubscriptions(params)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("listing EventSub subscriptions failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+		}
+
+		subs = append(subs, resp.Data.EventSubSubscriptions...)
+		if resp.Data.Pagination.Cursor == "" {
+			return subs, nil
+		}
+		params.After = resp.Data.Pagination.Cursor
+	}
+}
+
+// DropSubscription forgets a subscription Twitch has revoked and returns the
+// channel it belonged to, or false if it isn't one of ours
+func (c *Client) DropSubscription(id string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for channelName, subs := range c.subscriptions {
+		i := slices.IndexFunc(subs, func(sub subscription) bool { return sub.ID == id })
+		if i < 0 {
+			continue
+		}
+		if subs = slices.Delete(subs, i, i+1); len(subs) == 0 {
+			delete(c.subscriptions, channelName)
+		} else {
+			c.subscriptions[channelName] = subs
+		}
+		return channelName, true
+	}
+	return "", false
+}
+
+// GetSubscriptionCoverage reports, for every resolved channel, whether it is
+// covered by enabled subscriptions for all stream event types
+func (c *Client) GetSubscriptionCoverage() map[string]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	coverage := make(map[string]bool, len(c.channelIDs))
+	for channelName := range c.channelIDs {
+		enabled := make(map[string]bool)
+		for _, sub := range c.subscriptions[channelName] {
+			if sub.Status == helix.EventSubStatusEnabled {
+				enabled[sub.Type] = true
+			}
+		}
+
+		covered := true
+		for _, eventType := range streamEventTypes {
+			covered = covered && enabled[eventType]
+		}
+		coverage[channelName] = covered
+	}
+	return coverage
+}
+
+// DeleteSubscriptions removes every EventSub subscription this client created
+func (c *Client) DeleteSubscriptions() error {
+	var errs []error
+	for channelName := range c.GetSubscriptions() {
+		if err := c.deleteChannelSubscriptions(channelName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteChannelSubscriptions removes the EventSub subscriptions of one channel
+func (c *Client) deleteChannelSubscriptions(channelName string) error {
+	var errs []error
+	for _, id := range c.GetSubscriptions()[channelName] {
+		if err := c.DeleteSubscription(id); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete subscription %s for channel %s: %w", id, channelName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteSubscription removes an EventSub subscription by ID. It also works
+// for subscriptions this client did not create, such as leftovers from
+// another deployment. A subscription that no longer exists is not an error.
+func (c *Client) DeleteSubscription(id string) error {
+	resp, err := c.helixClient.RemoveEventSubSubscription(id)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 && resp.StatusCode != 404 {
+		return fmt.Errorf("deleting EventSub subscription failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for channelName, known := range c.subscriptions {
+		for i, sub := range known {
+			if sub.ID != id {
+				continue
+			}
+			if len(known) == 1 {
+				delete(c.subscriptions, channelName)
+			} else {
+				c.subscriptions[channelName] = append(known[:i:i], known[i+1:]...)
+			}
+			log.Printf("Deleted EventSub subscription %s for channel %s", id, channelName)
+			return nil
+		}
+	}
+
+	log.Printf("Deleted EventSub subscription %s", id)
+	return nil
+}
+
+// GetSubscriptions returns the EventSub subscription IDs for each channel
+func (c *Client) GetSubscriptions() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	subs := make(map[string][]string, len(c.subscriptions))
+	for name, known := range c.subscriptions {
+		for _, sub := range known {
+			subs[name] = append(subs[name], sub.ID)
+		}
+	}
+	return subs
+}
+
+// SetSubscriptions restores EventSub subscription IDs from a previous run.
+// Call it before SubscribeToStreamStatus so existing subscriptions are reused.
+func (c *Client) SetSubscriptions(subs map[string][]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subscriptions = make(map[string][]subscription, len(subs))
+	for name, ids := range subs {
+		for _, id := range ids {
+			c.subscriptions[name] = append(c.subscriptions[name], subscription{ID: id})
+		}
+	}
+}
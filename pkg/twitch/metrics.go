@@ -0,0 +1,28 @@
+package twitch
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/metrics"
+)
+
+// instrumentedHTTPClient records the latency and outcome of every Helix call
+type instrumentedHTTPClient struct {
+	client *http.Client
+}
+
+func (c *instrumentedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.client.Do(req)
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	endpoint := req.Method + " " + strings.TrimPrefix(req.URL.Path, "/helix")
+	metrics.ObserveHelix(endpoint, start, statusCode, err)
+
+	return resp, err
+}
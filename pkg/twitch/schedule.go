@@ -0,0 +1,116 @@
+package twitch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// ScheduleSegment is a broadcast from a channel's Twitch stream schedule
+type ScheduleSegment struct {
+	Title    string    `json:"title,omitempty"`
+	Category string    `json:"category,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// cachedSchedule is a channel's schedule as of fetchedAt
+type cachedSchedule struct {
+	segments  []ScheduleSegment
+	fetchedAt time.Time
+}
+
+// GetNextSegment returns the channel's next scheduled segment that has not
+// ended yet, or nil if there is none. The schedule is fetched from Helix when
+// the cached copy is older than maxAge.
+func (c *Client) GetNextSegment(channelName string, maxAge time.Duration) (*ScheduleSegment, error) {
+	c.mu.RLock()
+	cached, ok := c.schedules[channelName]
+	userID, resolved := c.channelIDs[channelName]
+	c.mu.RUnlock()
+
+	if !resolved {
+		return nil, fmt.Errorf("channel %s is not initialized", channelName)
+	}
+
+	if !ok || time.Since(cached.fetchedAt) > maxAge {
+		segments, err := c.fetchSchedule(userID)
+		if err != nil {
+			return nil, err
+		}
+		cached = cachedSchedule{segments: segments, fetchedAt: time.Now()}
+
+		c.mu.Lock()
+		c.schedules[channelName] = cached
+		c.mu.Unlock()
+	}
+
+	now := time.Now()
+	for _, segment := range cached.segments {
+		if segment.End.After(now) {
+			return &segment, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetCachedNextSegment returns the next segment from the cached schedule
+// without calling Helix, or nil if nothing is cached
+func (c *Client) GetCachedNextSegment(channelName string) *ScheduleSegment {
+	c.mu.RLock()
+	cached := c.schedules[channelName]
+	c.mu.RUnlock()
+
+	now := time.Now()
+	for _, segment := range cached.segments {
+		if segment.End.After(now) {
+			return &segment
+		}
+	}
+	return nil
+}
+
+// fetchSchedule returns the upcoming segments of a broadcaster's schedule,
+// leaving out cancelled segments and those during a vacation
+func (c *Client) fetchSchedule(userID string) ([]ScheduleSegment, error) {
+	resp, err := c.helixClient.GetSchedule(&helix.GetScheduleParams{
+		BroadcasterID: userID,
+		First:         10,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Channels that never set up a schedule return 404
+	if resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("getting schedule failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+	}
+
+	vacation := resp.Data.Schedule.Vacation
+	var segments []ScheduleSegment
+	for _, s := range resp.Data.Schedule.Segments {
+		if s.CanceledUntil != "" {
+			continue
+		}
+		if !vacation.StartTime.IsZero() && !s.StartTime.Before(vacation.StartTime.Time) && s.StartTime.Before(vacation.EndTime.Time) {
+			continue
+		}
+
+		end := s.EndTime.Time
+		if end.IsZero() {
+			// Segments without an end time are assumed to last an hour
+			end = s.StartTime.Add(time.Hour)
+		}
+		segments = append(segments, ScheduleSegment{
+			Title:    s.Title,
+			Category: s.Category.Name,
+			Start:    s.StartTime.Time,
+			End:      end,
+		})
+	}
+	return segments, nil
+}
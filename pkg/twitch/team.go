@@ -0,0 +1,158 @@
+package twitch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// helixBaseURL is used for the endpoints the helix library doesn't cover
+const helixBaseURL = "https://api.twitch.tv/helix"
+
+// teamMember is a member of a Twitch team
+type teamMember struct {
+	ID    string `json:"user_id"`
+	Login string `json:"user_login"`
+}
+
+// SetTeam makes the client monitor every member of a Twitch team. Members in
+// priority come first, in that order, followed by the rest of the team by
+// login. Channels monitored by name always take priority over the team.
+// Members are picked up by RefreshTeam.
+func (c *Client) SetTeam(teamName string, priority []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.teamName = strings.ToLower(teamName)
+	c.teamPriority = make([]string, len(priority))
+	for i, name := range priority {
+		c.teamPriority[i] = strings.ToLower(name)
+	}
+}
+
+// RefreshTeam expands the team into its current members, starts monitoring
+// and subscribing to members that joined and stops monitoring members that
+// left. It returns the logins that joined and left.
+func (c *Client) RefreshTeam(callbackURL, secret string) (joined, left []string, err error) {
+	c.mu.RLock()
+	teamName := c.teamName
+	c.mu.RUnlock()
+
+	if teamName == "" {
+		return nil, nil, nil
+	}
+
+	members, err := c.getTeamMembers(teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	isMember := make(map[string]bool, len(members))
+	c.mu.Lock()
+	for _, member := range members {
+		isMember[member.Login] = true
+		if _, monitored := c.channelIDs[member.Login]; monitored {
+			continue
+		}
+		c.channelIDs[member.Login] = member.ID
+		c.streamURLs[member.Login] = "https://twitch.tv/" + member.Login
+		c.channelNames = append(c.channelNames, member.Login)
+		c.teamMembers[member.Login] = true
+		joined = append(joined, member.Login)
+	}
+	for login := range c.teamMembers {
+		if !isMember[login] {
+			left = append(left, login)
+		}
+	}
+	c.sortTeamLocked()
+	c.mu.Unlock()
+
+	for _, login := range joined {
+		log.Printf("Team %s member %s joined, monitoring channel", teamName, login)
+		if err := c.SubscribeChannel(login, callbackURL, secret); err != nil {
+			// Polling covers the channel until a subscription works
+			log.Printf("Warning: Failed to subscribe to stream events for channel %s: %v", login, err)
+		}
+	}
+
+	var errs []error
+	for _, login := range left {
+		log.Printf("Team %s member %s left, no longer monitoring channel", teamName, login)
+		if err := c.RemoveChannel(login); err != nil {
+			errs = append(errs, fmt.Errorf("removing %s: %w", login, err))
+		}
+	}
+
+	return joined, left, errors.Join(errs...)
+}
+
+// sortTeamLocked orders team members after the channels monitored by name,
+// priority members first. Callers must hold mu.
+func (c *Client) sortTeamLocked() {
+	rank := func(login string) int {
+		if !c.teamMembers[login] {
+			return -1
+		}
+		if i := slices.Index(c.teamPriority, login); i >= 0 {
+			return i
+		}
+		return len(c.teamPriority)
+	}
+
+	slices.SortStableFunc(c.channelNames, func(a, b string) int {
+		ra, rb := rank(a), rank(b)
+		if ra != rb {
+			return ra - rb
+		}
+		if ra == len(c.teamPriority) {
+			return strings.Compare(a, b)
+		}
+		return 0
+	})
+}
+
+// getTeamMembers fetches the members of a team. The helix library has no
+// teams endpoint, so this calls Helix directly with the app access token.
+func (c *Client) getTeamMembers(teamName string) ([]teamMember, error) {
+	req, err := http.NewRequest(http.MethodGet, helixBaseURL+"/teams?name="+url.QueryEscape(teamName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	req.Header.Set("Authorization", "Bearer "+c.appToken)
+	c.mu.RUnlock()
+	req.Header.Set("Client-Id", c.clientID)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("team not found: %s", teamName)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting team failed with status code: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data []struct {
+			Users []teamMember `json:"users"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding team response: %w", err)
+	}
+	if len(body.Data) == 0 {
+		return nil, fmt.Errorf("team not found: %s", teamName)
+	}
+	return body.Data[0].Users, nil
+}
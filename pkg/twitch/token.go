@@ -0,0 +1,124 @@
+package twitch
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// authHTTPClient keeps the app access token fresh. The helix library only
+// refreshes user access tokens, so this renews the app token shortly before
+// it expires, and once when Helix rejects it, retrying the rejected request
+// with the new token.
+type authHTTPClient struct {
+	next   *instrumentedHTTPClient
+	client *Client // Owner of the token, set once the helix client exists
+
+	refreshMu sync.Mutex // Serializes token requests
+}
+
+func (a *authHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	// Token requests themselves go to the auth host and are passed through
+	authenticated := !strings.HasPrefix(req.URL.String(), helix.AuthBaseURL) && req.Header.Get("Authorization") != ""
+	if authenticated {
+		if _, expiry := a.client.GetAppAccessToken(); !expiry.IsZero() && time.Until(expiry) < tokenRefreshMargin {
+			if token, err := a.refresh(bearerToken(req)); err == nil {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+	}
+
+	resp, err := a.next.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !authenticated || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+
+	log.Println("Twitch rejected the app access token, requesting a new one")
+	token, refreshErr := a.refresh(bearerToken(req))
+	if refreshErr != nil {
+		log.Printf("Error refreshing app access token: %v", refreshErr)
+		return resp, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return resp, err
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	resp.Body.Close()
+	return a.next.Do(retry)
+}
+
+// refresh requests a new app access token unless another request already
+// replaced the stale one, and returns the current token
+func (a *authHTTPClient) refresh(stale string) (string, error) {
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+
+	if token, expiry := a.client.GetAppAccessToken(); token != stale && time.Until(expiry) >= tokenRefreshMargin {
+		return token, nil
+	}
+	if err := a.client.requestAppAccessToken(); err != nil {
+		return "", err
+	}
+	token, _ := a.client.GetAppAccessToken()
+	return token, nil
+}
+
+func bearerToken(req *http.Request) string {
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+}
+
+// requestAppAccessToken gets a new app access token and starts using it
+func (c *Client) requestAppAccessToken() error {
+	resp, err := c.helixClient.RequestAppAccessToken([]string{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting app access token failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+	}
+
+	c.mu.Lock()
+	c.appToken = resp.Data.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(resp.Data.ExpiresIn) * time.Second)
+	c.mu.Unlock()
+
+	c.helixClient.SetAppAccessToken(resp.Data.AccessToken)
+	log.Println("Obtained a new app access token")
+	return nil
+}
+
+// validateAppAccessToken checks a stored token with Twitch and reports whether
+// it still belongs to this client ID and has enough life left. On success the
+// expiry is updated from Twitch's answer.
+func (c *Client) validateAppAccessToken(token string) bool {
+	valid, resp, err := c.helixClient.ValidateToken(token)
+	if err != nil {
+		log.Printf("Warning: Could not validate stored app access token: %v", err)
+		return false
+	}
+	if !valid || resp.Data.ClientID != c.clientID {
+		log.Println("Stored app access token is no longer valid")
+		return false
+	}
+
+	expiry := time.Now().Add(time.Duration(resp.Data.ExpiresIn) * time.Second)
+	if time.Until(expiry) < tokenRefreshMargin {
+		return false
+	}
+
+	c.mu.Lock()
+	c.tokenExpiry = expiry
+	c.mu.Unlock()
+	return true
+}
@@ -0,0 +1,86 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nicklaw5/helix/v2"
+)
+
+// Video is a past broadcast, highlight or upload
+type Video struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// cachedVideo is the latest video of a type as of fetchedAt. video is nil if
+// the channel had none.
+type cachedVideo struct {
+	video     *Video
+	fetchedAt time.Time
+}
+
+// GetLatestVideo returns the channel's most recent video of the given type
+// ("archive", "highlight" or "upload"), or nil if it has none. The result is
+// cached until it is older than maxAge or InvalidateVideos is called.
+func (c *Client) GetLatestVideo(channelName, videoType string, maxAge time.Duration) (*Video, error) {
+	key := channelName + ":" + videoType
+
+	c.mu.RLock()
+	cached, ok := c.videos[key]
+	userID, resolved := c.channelIDs[channelName]
+	c.mu.RUnlock()
+
+	if !resolved {
+		return nil, fmt.Errorf("channel %s is not initialized", channelName)
+	}
+	if ok && time.Since(cached.fetchedAt) <= maxAge {
+		return cached.video, nil
+	}
+
+	resp, err := c.helixClient.GetVideos(&helix.VideosParams{
+		UserID: userID,
+		Type:   videoType,
+		First:  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("getting videos failed with status code: %d (%s)", resp.StatusCode, resp.ErrorMessage)
+	}
+
+	cached = cachedVideo{fetchedAt: time.Now()}
+	if len(resp.Data.Videos) > 0 {
+		v := resp.Data.Videos[0]
+		createdAt, _ := time.Parse(time.RFC3339, v.CreatedAt)
+		cached.video = &Video{ID: v.ID, Title: v.Title, URL: v.URL, Type: v.Type, CreatedAt: createdAt}
+	}
+
+	c.mu.Lock()
+	c.videos[key] = cached
+	c.mu.Unlock()
+
+	return cached.video, nil
+}
+
+// InvalidateVideos drops the cached videos of a channel, for example after a
+// stream ends and its archive becomes the latest video
+func (c *Client) InvalidateVideos(channelName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateVideosLocked(channelName)
+}
+
+// invalidateVideosLocked is InvalidateVideos for callers that hold mu
+func (c *Client) invalidateVideosLocked(channelName string) {
+	for key := range c.videos {
+		if name, _, _ := strings.Cut(key, ":"); name == channelName {
+			delete(c.videos, key)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// parseAllowedIPs parses IP addresses and CIDR ranges into prefixes
+func parseAllowedIPs(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed IP range %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed IP %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// isAllowed reports whether a request's remote address may post notifications
+func (s *WebhookServer) isAllowed(remoteAddr string) bool {
+	if len(s.allowedIPs) == 0 {
+		return true
+	}
+
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range s.allowedIPs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
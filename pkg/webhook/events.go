@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventSubNotification is the envelope of every EventSub webhook message.
+// Event is decoded into one of the event types below based on Subscription.Type.
+type EventSubNotification struct {
+	Subscription EventSubSubscription `json:"subscription"`
+	Event        json.RawMessage      `json:"event,omitempty"`
+	Challenge    string               `json:"challenge,omitempty"` // Only set for webhook_callback_verification
+}
+
+// EventSubSubscription describes the subscription a message was sent for
+type EventSubSubscription struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Status    string            `json:"status"`
+	Cost      int               `json:"cost"`
+	Condition map[string]string `json:"condition"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Stream types reported by stream.online
+const (
+	StreamTypeLive       = "live"
+	StreamTypePlaylist   = "playlist"
+	StreamTypeWatchParty = "watch_party"
+	StreamTypePremiere   = "premiere"
+	StreamTypeRerun      = "rerun"
+)
+
+// StreamTypes are all the stream types stream.online can report
+var StreamTypes = []string{StreamTypeLive, StreamTypePlaylist, StreamTypeWatchParty, StreamTypePremiere, StreamTypeRerun}
+
+// StreamOnlineEvent is the event of a stream.online notification
+type StreamOnlineEvent struct {
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`
+	StartedAt            time.Time `json:"started_at"`
+}
+
+// StreamOfflineEvent is the event of a stream.offline notification
+type StreamOfflineEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+}
+
+// ChannelUpdateEvent is the event of a channel.update notification
+type ChannelUpdateEvent struct {
+	BroadcasterUserID           string   `json:"broadcaster_user_id"`
+	BroadcasterUserLogin        string   `json:"broadcaster_user_login"`
+	BroadcasterUserName         string   `json:"broadcaster_user_name"`
+	Title                       string   `json:"title"`
+	Language                    string   `json:"language"`
+	CategoryID                  string   `json:"category_id"`
+	CategoryName                string   `json:"category_name"`
+	ContentClassificationLabels []string `json:"content_classification_labels"`
+}
+
+// ChannelRaidEvent is the event of a channel.raid notification
+type ChannelRaidEvent struct {
+	FromBroadcasterUserID    string `json:"from_broadcaster_user_id"`
+	FromBroadcasterUserLogin string `json:"from_broadcaster_user_login"`
+	FromBroadcasterUserName  string `json:"from_broadcaster_user_name"`
+	ToBroadcasterUserID      string `json:"to_broadcaster_user_id"`
+	ToBroadcasterUserLogin   string `json:"to_broadcaster_user_login"`
+	ToBroadcasterUserName    string `json:"to_broadcaster_user_name"`
+	Viewers                  int    `json:"viewers"`
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/metrics"
+)
+
+// queueSize bounds how many notifications can wait to be handled. Twitch
+// retries notifications that are rejected because the queue is full.
+const queueSize = 100
+
+// job is a notification that was acknowledged and is waiting to be handled
+type job struct {
+	handle     func()
+	enqueuedAt time.Time
+}
+
+// jobQueue hands notifications to a single worker, so they are handled in the
+// order they were received without holding up the response to Twitch
+type jobQueue struct {
+	mu     sync.Mutex // Guards closed and sends on jobs
+	closed bool
+	jobs   chan job
+	done   chan struct{}
+}
+
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		jobs: make(chan job, queueSize),
+		done: make(chan struct{}),
+	}
+}
+
+// run handles jobs until the queue is closed and drained
+func (q *jobQueue) run() {
+	defer close(q.done)
+	for j := range q.jobs {
+		metrics.WebhookQueueDepth.Set(float64(len(q.jobs)))
+		metrics.WebhookQueueLag.Observe(time.Since(j.enqueuedAt).Seconds())
+		j.handle()
+	}
+}
+
+// enqueue adds a job and reports whether there was room for it
+func (q *jobQueue) enqueue(handle func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- job{handle: handle, enqueuedAt: time.Now()}:
+		metrics.WebhookQueueDepth.Set(float64(len(q.jobs)))
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting jobs and waits for the queued ones to be handled
+func (q *jobQueue) close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
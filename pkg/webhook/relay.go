@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/delivery"
+	"github.com/treybastian/twitchlinker/pkg/metrics"
+)
+
+// Destination is a downstream service that notifications are relayed to
+type Destination struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"` // Signs relayed notifications the same way Twitch does
+	Types  []string `json:"types"`  // Subscription types to relay, empty for all
+}
+
+// LoadDestinations reads a JSON file of relay destinations
+func LoadDestinations(path string) ([]Destination, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read relay file: %w", err)
+	}
+
+	var cfg struct {
+		Destinations []Destination `json:"destinations"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse relay file: %w", err)
+	}
+
+	for i, d := range cfg.Destinations {
+		if d.URL == "" {
+			return nil, fmt.Errorf("relay destination %d has no url", i)
+		}
+		if d.Secret == "" {
+			return nil, fmt.Errorf("relay destination %s has no secret", d.URL)
+		}
+		if d.Name == "" {
+			cfg.Destinations[i].Name = d.URL
+		}
+	}
+	return cfg.Destinations, nil
+}
+
+// relay forwards a verified notification to a destination, re-signed with the
+// destination's secret
+type relay struct {
+	destination Destination
+	queue       *delivery.Queue
+}
+
+// relays fans notifications out to every destination
+type relays struct {
+	relays []relay
+}
+
+func newRelays(destinations []Destination) *relays {
+	rs := &relays{}
+	for _, d := range destinations {
+		rs.relays = append(rs.relays, relay{
+			destination: d,
+			queue: delivery.NewQueue(delivery.Config{
+				Name:         d.Name,
+				URL:          d.URL,
+				Secret:       d.Secret,
+				HeaderPrefix: "Twitch-Eventsub-",
+				Deliveries:   metrics.RelayDeliveries,
+			}),
+		})
+	}
+	return rs
+}
+
+// forward queues a notification for every destination that wants its type.
+// Destinations whose queue is full drop it.
+func (rs *relays) forward(messageID, subscriptionType string, body []byte) {
+	// Every attempt is signed with the same timestamp, so the destination
+	// sees a redelivery of the same message
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+
+	for _, r := range rs.relays {
+		if len(r.destination.Types) > 0 && !slices.Contains(r.destination.Types, subscriptionType) {
+			continue
+		}
+		r.queue.Send(delivery.Message{
+			ID:        messageID,
+			Timestamp: timestamp,
+			Body:      body,
+			Headers: map[string]string{
+				"Twitch-Eventsub-Message-Type":      "notification",
+				"Twitch-Eventsub-Subscription-Type": subscriptionType,
+			},
+			Description: subscriptionType + " notification",
+		})
+	}
+}
+
+// close stops accepting notifications and waits for the queued ones to be
+// delivered, abandoning retries once ctx is done
+func (rs *relays) close(ctx context.Context) error {
+	var errs []error
+	for _, r := range rs.relays {
+		errs = append(errs, r.queue.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// maxMessageAge is how old a message may be before it is rejected as a
+// possible replay, as recommended by Twitch
+const maxMessageAge = 10 * time.Minute
+
+// maxSeenMessages bounds how many message IDs are remembered
+const maxSeenMessages = 10000
+
+// seenMessages remembers the IDs of recently processed messages so that
+// retried deliveries aren't handled twice. IDs are forgotten after ttl, and
+// the oldest are evicted first when the cache is full.
+type seenMessages struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	max   int
+	ids   map[string]*list.Element
+	order *list.List // Of seenMessage, oldest first
+}
+
+type seenMessage struct {
+	id     string
+	seenAt time.Time
+}
+
+func newSeenMessages(ttl time.Duration, max int) *seenMessages {
+	return &seenMessages{
+		ttl:   ttl,
+		max:   max,
+		ids:   make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// add records a message ID and reports whether it was new
+func (c *seenMessages) add(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+	if _, ok := c.ids[id]; ok {
+		return false
+	}
+
+	for c.order.Len() >= c.max {
+		c.removeElement(c.order.Front())
+	}
+	c.ids[id] = c.order.PushBack(seenMessage{id: id, seenAt: now})
+	return true
+}
+
+// remove forgets a message ID so that a redelivery is processed again
+func (c *seenMessages) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.ids[id]; ok {
+		c.removeElement(e)
+	}
+}
+
+// expire drops IDs older than ttl. Callers must hold mu.
+func (c *seenMessages) expire(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		if now.Sub(e.Value.(seenMessage).seenAt) < c.ttl {
+			return
+		}
+		c.removeElement(e)
+	}
+}
+
+func (c *seenMessages) removeElement(e *list.Element) {
+	delete(c.ids, e.Value.(seenMessage).id)
+	c.order.Remove(e)
+}
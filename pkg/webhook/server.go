@@ -1,62 +1,232 @@
 package webhook
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/treybastian/twitchlinker/pkg/metrics"
 )
 
+// StreamStatusHandler receives stream events along with the time Twitch sent
+// them, and subscriptions Twitch has revoked
 type StreamStatusHandler interface {
-	HandleStreamOnline(channelName string) error
-	HandleStreamOffline(channelName string) error
+	HandleStreamOnline(event *StreamOnlineEvent, sentAt time.Time) error
+	HandleStreamOffline(event *StreamOfflineEvent, sentAt time.Time) error
+	HandleRevocation(subscription *EventSubSubscription) error
 }
 
-type WebhookServer struct {
-	port      string
-	secretKey string
-	handler   StreamStatusHandler
+// Timeouts of the HTTP server. The write timeout leaves room for admin API
+// calls that wait on Helix.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 10 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
+// maxBodySize bounds webhook request bodies. EventSub notifications are a few
+// kilobytes at most.
+const maxBodySize = 1 << 20
+
+// Config configures a WebhookServer
+type Config struct {
+	Port            string
+	Addr            string // host:port or unix:/path/to/socket to listen on, empty for all interfaces on Port
+	TLSCertFile     string // Serve TLS with this certificate and TLSKeyFile, empty for plain HTTP
+	TLSKeyFile      string
+	Secret          string
+	PreviousSecrets []string      // Secrets still accepted while subscriptions move to Secret
+	CallbackPath    string        // Path Twitch posts notifications to, e.g. "/webhook"
+	AllowedIPs      []string      // IPs or CIDR ranges allowed to post notifications, empty to allow any
+	Relay           []Destination // Downstream services verified notifications are forwarded to
 }
 
-type EventSubNotification struct {
-	Subscription struct {
-		ID   string `json:"id"`
-		Type string `json:"type"`
-	} `json:"subscription"`
-	Event map[string]interface{} `json:"event"`
+type WebhookServer struct {
+	addr         string
+	certs        *certReloader // nil when serving plain HTTP
+	stopWatching chan struct{}
+	secretsMu    sync.RWMutex
+	secrets      []string // Secrets notifications may be signed with
+	callbackPath string
+	allowedIPs   []netip.Prefix
+	handler      StreamStatusHandler
+	mux          *http.ServeMux
+	server       *http.Server
+	seen         *seenMessages // Message IDs already processed, to skip retried deliveries
+	queue        *jobQueue     // Notifications acknowledged but not yet handled
+	relays       *relays       // Forwards notifications to downstream services
 }
 
-func NewWebhookServer(port, secretKey string, handler StreamStatusHandler) *WebhookServer {
-	return &WebhookServer{
-		port:      port,
-		secretKey: secretKey,
-		handler:   handler,
+func NewWebhookServer(config Config, handler StreamStatusHandler) (*WebhookServer, error) {
+	if config.CallbackPath == "" {
+		config.CallbackPath = "/webhook"
+	}
+	allowedIPs, err := parseAllowedIPs(config.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Addr == "" {
+		config.Addr = ":" + config.Port
+	}
+	// Requests on a Unix socket have no client IP to check
+	if strings.HasPrefix(config.Addr, "unix:") && len(allowedIPs) > 0 {
+		return nil, errors.New("an IP allowlist can't be used when listening on a Unix socket, enforce it at the reverse proxy instead")
+	}
+
+	var certs *certReloader
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		if certs, err = newCertReloader(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			return nil, err
+		}
 	}
+
+	mux := http.NewServeMux()
+	queue := newJobQueue()
+	go queue.run()
+
+	s := &WebhookServer{
+		addr:         config.Addr,
+		certs:        certs,
+		stopWatching: make(chan struct{}),
+		secrets:      append([]string{config.Secret}, config.PreviousSecrets...),
+		callbackPath: config.CallbackPath,
+		allowedIPs:   allowedIPs,
+		handler:      handler,
+		mux:          mux,
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+			ReadTimeout:       readTimeout,
+			WriteTimeout:      writeTimeout,
+			IdleTimeout:       idleTimeout,
+		},
+		seen:   newSeenMessages(maxMessageAge, maxSeenMessages),
+		queue:  queue,
+		relays: newRelays(config.Relay),
+	}
+	// Only match the callback path exactly, not everything below it
+	pattern := "POST " + config.CallbackPath
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "{$}"
+	}
+	mux.HandleFunc(pattern, s.handleWebhook)
+	return s, nil
 }
 
+// Start serves webhooks until Shutdown is called
 func (s *WebhookServer) Start() error {
-	http.HandleFunc("/webhook", s.handleWebhook)
+	listener, err := listen(s.addr)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("Starting webhook server on port %s", s.port)
-	return http.ListenAndServe(":"+s.port, nil)
+	if s.certs == nil {
+		log.Printf("Starting webhook server on %s, receiving notifications at %s", s.addr, s.callbackPath)
+		err = s.server.Serve(listener)
+	} else {
+		s.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certs.getCertificate,
+		}
+		go s.certs.watch(s.stopWatching)
+
+		log.Printf("Starting webhook server with TLS on %s, receiving notifications at %s", s.addr, s.callbackPath)
+		err = s.server.ServeTLS(listener, "", "")
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listen opens a TCP listener on host:port, or a Unix socket for unix:/path
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// Remove a socket left behind by a previous run that didn't shut down cleanly
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// Handle registers an additional HTTP handler on the webhook server
+func (s *WebhookServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests and
+// queued notifications to finish
+func (s *WebhookServer) Shutdown(ctx context.Context) error {
+	close(s.stopWatching)
+	err := s.server.Shutdown(ctx)
+	return errors.Join(err, s.queue.close(ctx), s.relays.close(ctx))
 }
 
 func (s *WebhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
-	// Verify the webhook is from Twitch
-	if !s.verifyTwitchSignature(r) {
-		log.Println("Invalid webhook signature")
-		w.WriteHeader(http.StatusUnauthorized)
+	if !s.isAllowed(r.RemoteAddr) {
+		log.Printf("Rejecting webhook from %s, not in the allowed IPs", r.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
 	// Read the request body
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
 	if err != nil {
 		log.Printf("Error reading request body: %v", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Verify the webhook is from Twitch
+	if !s.verifyTwitchSignature(r, body) {
+		log.Println("Invalid webhook signature")
+		metrics.SignatureFailures.Inc()
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Reject replays of old messages. Anything older than the cache TTL could
+	// otherwise be processed twice.
+	sentAt, err := time.Parse(time.RFC3339Nano, r.Header.Get("Twitch-Eventsub-Message-Timestamp"))
+	if err != nil || !isRecent(sentAt) {
+		log.Println("Rejecting webhook with a stale or invalid timestamp")
+		metrics.StaleMessages.Inc()
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// Parse the envelope
+	var notification EventSubNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		log.Printf("Error unmarshaling notification: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -64,66 +234,144 @@ func (s *WebhookServer) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	// Handle verification challenge
 	messageType := r.Header.Get("Twitch-Eventsub-Message-Type")
 	if messageType == "webhook_callback_verification" {
-		var challenge struct {
-			Challenge string `json:"challenge"`
-		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(notification.Challenge))
+		log.Println("Successfully responded to webhook verification challenge")
+		return
+	}
 
-		if err := json.Unmarshal(body, &challenge); err != nil {
-			log.Printf("Error unmarshaling verification challenge: %v", err)
-			w.WriteHeader(http.StatusBadRequest)
+	// Twitch retries deliveries with the same message ID, acknowledge those
+	// without handling them again
+	messageID := r.Header.Get("Twitch-Eventsub-Message-Id")
+	if !s.seen.add(messageID) {
+		log.Printf("Acknowledging duplicate message %s", messageID)
+		metrics.DuplicateMessages.Inc()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// A revocation carries no event, only the subscription and why Twitch
+	// stopped it. Acknowledge it like any other message or Twitch retries.
+	if messageType == "revocation" {
+		sub := notification.Subscription
+		log.Printf("Twitch revoked %s subscription %s: %s", sub.Type, sub.ID, sub.Status)
+		if !s.queue.enqueue(func() {
+			if err := s.handler.HandleRevocation(&sub); err != nil {
+				log.Printf("Error handling revocation of subscription %s: %v", sub.ID, err)
+			}
+		}) {
+			log.Printf("Webhook queue is full, rejecting revocation of subscription %s", sub.ID)
+			metrics.WebhookQueueRejections.Inc()
+			s.seen.remove(messageID)
+			w.WriteHeader(http.StatusServiceUnavailable)
 			return
 		}
-
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(challenge.Challenge))
-		log.Println("Successfully responded to webhook verification challenge")
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	// Parse the notification
-	var notification EventSubNotification
-	if err := json.Unmarshal(body, &notification); err != nil {
-		log.Printf("Error unmarshaling notification: %v", err)
+	handle, err := s.dispatch(&notification, sentAt)
+	if err != nil {
+		log.Printf("Error decoding %s event: %v", notification.Subscription.Type, err)
+		s.seen.remove(messageID)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Process the event
+	// Acknowledge right away and handle the event in the background, so a slow
+	// Helix or Cloudflare call can't make Twitch time out and retry
+	if !s.queue.enqueue(handle) {
+		log.Printf("Webhook queue is full, rejecting %s notification", notification.Subscription.Type)
+		metrics.WebhookQueueRejections.Inc()
+		s.seen.remove(messageID)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	metrics.EventSubNotifications.WithLabelValues(notification.Subscription.Type).Inc()
+	if messageType == "notification" {
+		s.relays.forward(messageID, notification.Subscription.Type, body)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// dispatch decodes a notification's event and returns a function that passes
+// it to the handler. Errors from the handler are logged; only malformed events
+// are returned.
+func (s *WebhookServer) dispatch(notification *EventSubNotification, sentAt time.Time) (func(), error) {
 	switch notification.Subscription.Type {
 	case "stream.online":
-		broadcasterUserLogin, ok := notification.Event["broadcaster_user_login"].(string)
-		if !ok {
-			log.Println("Error: couldn't get broadcaster_user_login from event")
-			w.WriteHeader(http.StatusBadRequest)
-			return
+		var event StreamOnlineEvent
+		if err := decodeEvent(notification.Event, &event); err != nil {
+			return nil, err
 		}
-
-		log.Printf("Stream online event received for channel: %s", broadcasterUserLogin)
-		if err := s.handler.HandleStreamOnline(broadcasterUserLogin); err != nil {
-			log.Printf("Error handling stream online event: %v", err)
+		if event.BroadcasterUserLogin == "" {
+			return nil, errMissingBroadcaster
 		}
+		return func() {
+			log.Printf("Stream online event received for channel: %s (type %s)", event.BroadcasterUserLogin, event.Type)
+			if err := s.handler.HandleStreamOnline(&event, sentAt); err != nil {
+				log.Printf("Error handling stream online event: %v", err)
+			}
+		}, nil
 
 	case "stream.offline":
-		broadcasterUserLogin, ok := notification.Event["broadcaster_user_login"].(string)
-		if !ok {
-			log.Println("Error: couldn't get broadcaster_user_login from event")
-			w.WriteHeader(http.StatusBadRequest)
-			return
+		var event StreamOfflineEvent
+		if err := decodeEvent(notification.Event, &event); err != nil {
+			return nil, err
+		}
+		if event.BroadcasterUserLogin == "" {
+			return nil, errMissingBroadcaster
 		}
+		return func() {
+			log.Printf("Stream offline event received for channel: %s", event.BroadcasterUserLogin)
+			if err := s.handler.HandleStreamOffline(&event, sentAt); err != nil {
+				log.Printf("Error handling stream offline event: %v", err)
+			}
+		}, nil
 
-		log.Printf("Stream offline event received for channel: %s", broadcasterUserLogin)
-		if err := s.handler.HandleStreamOffline(broadcasterUserLogin); err != nil {
-			log.Printf("Error handling stream offline event: %v", err)
+	case "channel.update":
+		var event ChannelUpdateEvent
+		if err := decodeEvent(notification.Event, &event); err != nil {
+			return nil, err
+		}
+		if event.BroadcasterUserLogin == "" {
+			return nil, errMissingBroadcaster
 		}
+		return func() {
+			log.Printf("Channel %s updated: %q in %s", event.BroadcasterUserLogin, event.Title, event.CategoryName)
+		}, nil
+
+	case "channel.raid":
+		var event ChannelRaidEvent
+		if err := decodeEvent(notification.Event, &event); err != nil {
+			return nil, err
+		}
+		if event.FromBroadcasterUserLogin == "" {
+			return nil, errMissingBroadcaster
+		}
+		return func() {
+			log.Printf("Channel %s raided %s with %d viewers", event.FromBroadcasterUserLogin, event.ToBroadcasterUserLogin, event.Viewers)
+		}, nil
 
 	default:
-		log.Printf("Received unhandled event type: %s", notification.Subscription.Type)
+		return func() {
+			log.Printf("Received unhandled event type: %s", notification.Subscription.Type)
+		}, nil
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+var errMissingBroadcaster = errors.New("event has no broadcaster login")
+
+// decodeEvent unmarshals the event of a notification into v
+func decodeEvent(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return errors.New("notification has no event")
+	}
+	return json.Unmarshal(raw, v)
 }
 
-func (s *WebhookServer) verifyTwitchSignature(r *http.Request) bool {
+func (s *WebhookServer) verifyTwitchSignature(r *http.Request, body []byte) bool {
 	messageID := r.Header.Get("Twitch-Eventsub-Message-Id")
 	timestamp := r.Header.Get("Twitch-Eventsub-Message-Timestamp")
 	signature := r.Header.Get("Twitch-Eventsub-Message-Signature")
@@ -132,20 +380,42 @@ func (s *WebhookServer) verifyTwitchSignature(r *http.Request) bool {
 		return false
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return false
-	}
-	// Replace the body so it can be read again
-	r.Body = io.NopCloser(bytes.NewReader(body))
-
 	// Create the message used to compute the signature
 	message := messageID + timestamp + string(body)
 
-	// Compute the HMAC
-	h := hmac.New(sha256.New, []byte(s.secretKey))
-	h.Write([]byte(message))
-	expectedSignature := "sha256=" + hex.EncodeToString(h.Sum(nil))
+	// Any of the secrets may have signed it while they are being rotated
+	s.secretsMu.RLock()
+	defer s.secretsMu.RUnlock()
+	for _, secret := range s.secrets {
+		h := hmac.New(sha256.New, []byte(secret))
+		h.Write([]byte(message))
+		expectedSignature := "sha256=" + hex.EncodeToString(h.Sum(nil))
+		if hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSecret accepts notifications signed with secret in addition to the
+// current secrets
+func (s *WebhookServer) AddSecret(secret string) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	if !slices.Contains(s.secrets, secret) {
+		s.secrets = append(s.secrets, secret)
+	}
+}
+
+// RetireSecrets stops accepting notifications signed with any secret but keep
+func (s *WebhookServer) RetireSecrets(keep string) {
+	s.secretsMu.Lock()
+	defer s.secretsMu.Unlock()
+	s.secrets = []string{keep}
+}
 
-	return signature == expectedSignature
+// isRecent reports whether a message timestamp is within maxMessageAge of now
+func isRecent(t time.Time) bool {
+	age := time.Since(t)
+	return age < maxMessageAge && age > -maxMessageAge
 }